@@ -0,0 +1,280 @@
+// Package cassette records HTTP interactions with the Lambda Cloud API to
+// sanitized files and replays them, so acceptance tests can run without
+// credentials once a cassette has been recorded.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// EnvMode selects the cassette mode for acceptance tests.
+const EnvMode = "LAMBDA_CASSETTE_MODE"
+
+type Mode string
+
+const (
+	// ModeOff sends requests to the real API without recording them.
+	ModeOff Mode = ""
+	// ModeRecord sends requests to the real API and saves the interactions.
+	ModeRecord Mode = "record"
+	// ModeReplay answers requests from a previously recorded cassette.
+	ModeReplay Mode = "replay"
+)
+
+// ErrNotRecorded is returned when replaying a cassette that does not exist.
+var ErrNotRecorded = errors.New("cassette not recorded")
+
+// ModeFromEnv reads the mode from LAMBDA_CASSETTE_MODE.
+func ModeFromEnv() (Mode, error) {
+	switch mode := Mode(os.Getenv(EnvMode)); mode {
+	case ModeOff, ModeRecord, ModeReplay:
+		return mode, nil
+	default:
+		return ModeOff, fmt.Errorf("invalid %s %q, expected %q or %q", EnvMode, mode, ModeRecord, ModeReplay)
+	}
+}
+
+const redacted = "REDACTED"
+
+// redactedFields are JSON keys whose values never make it into a cassette.
+var redactedFields = map[string]bool{
+	"private_key":   true,
+	"jupyter_token": true,
+	"jupyter_url":   true,
+	"hostname":      true,
+	"api_key":       true,
+}
+
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// sanitizedIP replaces every IPv4 address, it is taken from the documentation
+// range so it never points at a real machine.
+const sanitizedIP = "192.0.2.1"
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the on disk format of a recording.
+type Cassette struct {
+	// Vars holds values a test generated while recording, such as random
+	// resource names, so replays configure the exact same resources.
+	Vars         map[string]string `json:"vars,omitempty"`
+	Interactions []Interaction     `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records or replays a cassette.
+type Recorder struct {
+	mode Mode
+	file string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	// replayed tracks which interactions were already served.
+	replayed []bool
+}
+
+// New opens the cassette stored in file. In record mode requests are sent
+// through next, which defaults to http.DefaultTransport.
+func New(file string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	r := &Recorder{mode: mode, file: file, next: next}
+	if mode != ModeReplay {
+		r.cassette.Vars = map[string]string{}
+		return r, nil
+	}
+	raw, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &r.cassette); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", file, err)
+	}
+	r.replayed = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Mode reports whether the recorder is recording or replaying.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Var returns the value stored under name, generating and remembering it when
+// recording.
+func (r *Recorder) Var(name string, generate func() string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.cassette.Vars[name]; ok {
+		return v
+	}
+	v := generate()
+	if r.cassette.Vars == nil {
+		r.cassette.Vars = map[string]string{}
+	}
+	r.cassette.Vars[name] = v
+	return v
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req)
+	}
+
+	res, err := r.next.RoundTrip(req)
+	if err != nil || r.mode != ModeRecord {
+		return res, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.RequestURI(),
+			Body:   sanitize(body),
+		},
+		Response: Response{
+			Status:      res.StatusCode,
+			ContentType: res.Header.Get("Content-Type"),
+			Body:        sanitize(resBody),
+		},
+	})
+	return res, nil
+}
+
+// replay serves the first interaction not yet used with the same method and
+// path. Bodies are not compared, they carry redacted and generated values.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.replayed[i] || interaction.Request.Method != req.Method || interaction.Request.Path != req.URL.RequestURI() {
+			continue
+		}
+		r.replayed[i] = true
+		header := http.Header{}
+		if interaction.Response.ContentType != "" {
+			header.Set("Content-Type", interaction.Response.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s has no more recorded %s %s interactions, re-record it with %s=%s", r.file, req.Method, req.URL.RequestURI(), EnvMode, ModeRecord)
+}
+
+// Stop writes the cassette to disk when recording.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	raw, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, append(raw, '\n'), 0o644)
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// sanitize strips secrets and addresses from a request or response body.
+func sanitize(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return ipv4Pattern.ReplaceAllString(string(body), sanitizedIP)
+	}
+	raw, err := json.Marshal(redact(doc))
+	if err != nil {
+		return redacted
+	}
+	return string(raw)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, isString := value.(string); isString && redactedFields[key] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redact(value)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+		return v
+	case string:
+		return ipv4Pattern.ReplaceAllString(v, sanitizedIP)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,102 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("secret-api-key", "")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := lambdamock.NewServer(lambdamock.Options{})
+	defer srv.Close()
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	rec, err := New(file, ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := rec.Var("name", func() string { return "generated" })
+	client := &http.Client{Transport: rec}
+	req, _ := http.NewRequest(http.MethodPost, srv.Endpoint()+"/instance-operations/launch",
+		bytes.NewBufferString(`{"region_name":"us-west-1","instance_type_name":"gpu_1x_a10","ssh_key_names":["laptop"]}`))
+	req.SetBasicAuth("secret-api-key", "")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	_, recorded := get(t, client, srv.Endpoint()+"/instances")
+	if !strings.Contains(recorded, "jupyter_token") {
+		t.Fatalf("expected a full instance listing, got %s", recorded)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-api-key", "10.0.0.2", "jt0000"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("cassette leaks %q", secret)
+		}
+	}
+
+	srv.Close()
+	replay, err := New(file, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := replay.Var("name", func() string { return "other" }); got != name {
+		t.Errorf("replayed var = %q, want %q", got, name)
+	}
+	client = &http.Client{Transport: replay}
+	status, replayed := get(t, client, srv.Endpoint()+"/instances")
+	if status != http.StatusOK || !strings.Contains(replayed, sanitizedIP) {
+		t.Errorf("unexpected replay %d %s", status, replayed)
+	}
+	if _, err := client.Get(srv.Endpoint() + "/instances"); err == nil {
+		t.Error("expected an error once the recorded interactions are used up")
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay, nil)
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded, got %v", err)
+	}
+}
+
+func TestSanitizeNonJSON(t *testing.T) {
+	if got := sanitize([]byte("upstream 10.1.2.3 timed out")); got != "upstream 192.0.2.1 timed out" {
+		t.Errorf("sanitize = %q", got)
+	}
+}
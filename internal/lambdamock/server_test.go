@@ -0,0 +1,153 @@
+package lambdamock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func do(t *testing.T, s *Server, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, s.Endpoint()+"/"+path, bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("secret", "")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func launch(t *testing.T, s *Server, quantity int) (int, []string) {
+	t.Helper()
+	var resp struct {
+		Data struct {
+			InstanceIDs []string `json:"instance_ids"`
+		} `json:"data"`
+	}
+	status := do(t, s, http.MethodPost, "instance-operations/launch", launchRequest{
+		RegionName:       "us-west-1",
+		InstanceTypeName: "gpu_1x_a10",
+		SSHKeyNames:      []string{"laptop"},
+		Quantity:         quantity,
+	}, &resp)
+	return status, resp.Data.InstanceIDs
+}
+
+func TestServerInstanceLifecycle(t *testing.T) {
+	s := NewServer(Options{APIKey: "secret"})
+	defer s.Close()
+	s.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+
+	clock := time.Now()
+	s.now = func() time.Time { return clock }
+	s.opts.BootTime = time.Minute
+	s.opts.TerminateTime = time.Minute
+
+	status, ids := launch(t, s, 2)
+	if status != http.StatusOK || len(ids) != 2 {
+		t.Fatalf("launch returned %d with %v", status, ids)
+	}
+	if inst, _ := s.Instance(ids[0]); inst.Status != StatusBooting || inst.IP != "" {
+		t.Fatalf("expected a booting instance without ip, got %+v", inst)
+	}
+
+	clock = clock.Add(time.Minute)
+	if inst, _ := s.Instance(ids[0]); inst.Status != StatusActive || inst.IP == "" {
+		t.Fatalf("expected an active instance with an ip, got %+v", inst)
+	}
+
+	if status := do(t, s, http.MethodPost, "instance-operations/terminate", instanceIDsRequest{InstanceIDs: ids[:1]}, nil); status != http.StatusOK {
+		t.Fatalf("terminate returned %d", status)
+	}
+	if inst, _ := s.Instance(ids[0]); inst.Status != StatusTerminated {
+		t.Fatalf("expected a terminated instance, got %+v", inst)
+	}
+
+	clock = clock.Add(time.Minute)
+	if _, ok := s.Instance(ids[0]); ok {
+		t.Fatal("terminated instance is still listed")
+	}
+	if status := do(t, s, http.MethodGet, "instances/"+ids[0], nil, nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a terminated instance, got %d", status)
+	}
+	if n := len(s.Instances()); n != 1 {
+		t.Fatalf("expected 1 instance left, got %d", n)
+	}
+}
+
+func TestServerCapacity(t *testing.T) {
+	s := NewServer(Options{})
+	defer s.Close()
+	s.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	s.SetCapacity("gpu_1x_a10", "us-west-1", 1)
+
+	if status, _ := launch(t, s, 2); status != http.StatusBadRequest {
+		t.Fatalf("expected capacity error, got %d", status)
+	}
+	if status, _ := launch(t, s, 1); status != http.StatusOK {
+		t.Fatalf("expected launch to succeed, got %d", status)
+	}
+
+	var errResp errorResponse
+	do(t, s, http.MethodPost, "instance-operations/launch", launchRequest{
+		RegionName:       "us-west-1",
+		InstanceTypeName: "gpu_1x_a10",
+		SSHKeyNames:      []string{"laptop"},
+	}, &errResp)
+	if errResp.Error.Code != CodeInsufficientCapacity {
+		t.Fatalf("expected %s, got %+v", CodeInsufficientCapacity, errResp)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(Options{APIKey: "secret"})
+	defer s.Close()
+	s.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+
+	s.AddFault(Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusBadGateway, AfterCommit: true})
+	if status, _ := launch(t, s, 1); status != http.StatusBadGateway {
+		t.Fatalf("expected injected 502, got %d", status)
+	}
+	if n := len(s.Instances()); n != 1 {
+		t.Fatalf("expected the failed launch to be committed, got %d instances", n)
+	}
+	if status, ids := launch(t, s, 1); status != http.StatusOK || len(ids) != 1 {
+		t.Fatalf("fault fired more than once: %d", status)
+	}
+	if n := s.RequestCount(http.MethodPost, "instance-operations/launch"); n != 2 {
+		t.Fatalf("expected 2 recorded launches, got %d", n)
+	}
+}
+
+func TestServerImages(t *testing.T) {
+	s := NewServer(Options{Images: []Image{{ID: "img-1", Family: "lambda-stack-22-04"}}})
+	defer s.Close()
+
+	var resp struct {
+		Data []Image `json:"data"`
+	}
+	if status := do(t, s, http.MethodGet, "images", nil, &resp); status != http.StatusOK {
+		t.Fatalf("GET images returned %d", status)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != "img-1" {
+		t.Errorf("unexpected images %+v", resp.Data)
+	}
+}
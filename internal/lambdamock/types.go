@@ -0,0 +1,116 @@
+package lambdamock
+
+// The types below mirror the JSON documents served by the Lambda Cloud API.
+// They are deliberately independent of the provider's own types so that the
+// provider's decoding is exercised against the documented wire format.
+
+type Region struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Specs struct {
+	VCPUs      int `json:"vcpus"`
+	MemoryGiB  int `json:"memory_gib"`
+	StorageGiB int `json:"storage_gib"`
+	GPUs       int `json:"gpus"`
+}
+
+type InstanceType struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	PriceCentsHourly int    `json:"price_cents_per_hour"`
+	Specs            Specs  `json:"specs"`
+}
+
+type Image struct {
+	ID           string `json:"id"`
+	CreatedTime  string `json:"created_time"`
+	UpdatedTime  string `json:"updated_time"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Family       string `json:"family"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Region       Region `json:"region"`
+}
+
+type Instance struct {
+	ID              string       `json:"id"`
+	Name            *string      `json:"name"`
+	IP              string       `json:"ip,omitempty"`
+	Status          string       `json:"status"`
+	SSHKeyNames     []string     `json:"ssh_key_names"`
+	FileSystemNames []string     `json:"file_system_names"`
+	Region          Region       `json:"region"`
+	InstanceType    InstanceType `json:"instance_type"`
+	Hostname        string       `json:"hostname,omitempty"`
+	JupyterToken    string       `json:"jupyter_token,omitempty"`
+	JupyterURL      string       `json:"jupyter_url,omitempty"`
+	Tags            []Tag        `json:"tags"`
+}
+
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type SSHKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+type FileSystem struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Created    string `json:"created"`
+	MountPoint string `json:"mount_point"`
+	Region     Region `json:"region"`
+	IsInUse    bool   `json:"is_in_use"`
+	BytesUsed  int64  `json:"bytes_used"`
+}
+
+type APIError struct {
+	Code       string  `json:"code"`
+	Message    string  `json:"message"`
+	Suggestion *string `json:"suggestion,omitempty"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type dataResponse struct {
+	Data interface{} `json:"data"`
+}
+
+type launchRequest struct {
+	RegionName       string   `json:"region_name"`
+	InstanceTypeName string   `json:"instance_type_name"`
+	SSHKeyNames      []string `json:"ssh_key_names"`
+	FileSystemNames  []string `json:"file_system_names"`
+	Quantity         int      `json:"quantity"`
+	Name             *string  `json:"name"`
+	Tags             []Tag    `json:"tags"`
+}
+
+type instanceIDsRequest struct {
+	InstanceIDs []string `json:"instance_ids"`
+}
+
+type sshKeyRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+type fileSystemRequest struct {
+	Name       string `json:"name"`
+	RegionName string `json:"region"`
+}
+
+type instanceTypeAvailability struct {
+	InstanceType InstanceType `json:"instance_type"`
+	Regions      []Region     `json:"regions_with_capacity_available"`
+}
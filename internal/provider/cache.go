@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// listCacheTTL is how long a list response is reused. A refresh reads every
+// resource within a few seconds, so this is enough to serve a whole plan
+// from one request per endpoint while staying fresh across applies.
+const listCacheTTL = 10 * time.Second
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// listCache shares GET responses of list endpoints between resources.
+// Concurrent misses for the same endpoint are collapsed into one request and
+// any mutation through the client invalidates everything cached.
+type listCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// urls are all endpoints ever fetched, requests for them may be in
+	// flight whether or not a response is cached.
+	urls       map[string]bool
+	generation uint64
+}
+
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+		urls:    map[string]bool{},
+	}
+}
+
+func (c *listCache) get(url string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok || c.now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// put stores a response unless the cache was invalidated since the request
+// that produced it started.
+func (c *listCache) put(url string, body []byte, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries[url] = cacheEntry{body: body, expires: c.now().Add(c.ttl)}
+}
+
+// begin records a fetch of url and returns the generation it belongs to.
+func (c *listCache) begin(url string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.urls[url] = true
+	return c.generation
+}
+
+func (c *listCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	// Requests still in flight started before the mutation, later callers
+	// must not join them.
+	for url := range c.urls {
+		c.group.Forget(url)
+	}
+	c.entries = map[string]cacheEntry{}
+}
+
+// cachedGet decodes the response of a GET request into out, serving it from
+// the list cache when possible.
+func (c *LambdaClient) cachedGet(ctx context.Context, url string, out interface{}) error {
+	body, ok := c.cache.get(url)
+	if !ok {
+		generation := c.cache.begin(url)
+		v, err, _ := c.cache.group.Do(url, func() (interface{}, error) {
+			res, err := c.MakeAPICall(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return nil, readAPIError(res)
+			}
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				return nil, err
+			}
+			c.cache.put(url, body, generation)
+			return body, nil
+		})
+		if err != nil {
+			return err
+		}
+		body, _ = v.([]byte)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// ListInstances returns every instance of the account.
+func (c *LambdaClient) ListInstances(ctx context.Context) ([]Instance, error) {
+	var respData InstanceListAPIResponse
+	if err := c.cachedGet(ctx, "instances", &respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
+
+// ListSSHKeys returns every SSH key of the account.
+func (c *LambdaClient) ListSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	var respData SSHKeyListResponse
+	if err := c.cachedGet(ctx, "ssh-keys", &respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
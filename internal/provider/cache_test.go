@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func TestListCacheCollapsesConcurrentReads(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{Latency: 50 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := client.ListSSHKeys(context.Background())
+			if err != nil || len(keys) != 1 {
+				t.Errorf("ListSSHKeys() = %v, %v", keys, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := client.ListSSHKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := srv.RequestCount(http.MethodGet, "ssh-keys"); n != 1 {
+		t.Errorf("expected a single ssh-keys request, got %d", n)
+	}
+}
+
+func TestListCacheInvalidation(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	now := time.Now()
+	client.cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if keys, _ := client.ListSSHKeys(ctx); len(keys) != 1 {
+		t.Fatalf("expected one key, got %v", keys)
+	}
+	res, err := client.MakeAPICall(ctx, http.MethodPost, "ssh-keys", SSHKeyCreateRequest{Name: "ci", PublicKey: "ssh-ed25519 BBBB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if keys, _ := client.ListSSHKeys(ctx); len(keys) != 2 {
+		t.Fatalf("mutation did not invalidate the cache, got %v", keys)
+	}
+
+	srv.AddSSHKey("desktop", "ssh-ed25519 CCCC")
+	if keys, _ := client.ListSSHKeys(ctx); len(keys) != 2 {
+		t.Fatalf("expected the cached listing, got %v", keys)
+	}
+	now = now.Add(listCacheTTL + time.Second)
+	if keys, _ := client.ListSSHKeys(ctx); len(keys) != 3 {
+		t.Fatalf("expected the listing to expire, got %v", keys)
+	}
+	if n := srv.RequestCount(http.MethodGet, "ssh-keys"); n != 3 {
+		t.Errorf("expected 3 ssh-keys requests, got %d", n)
+	}
+}
+
+func TestListCacheDoesNotCacheErrors(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	srv.AddFault(lambdamock.Fault{Method: http.MethodGet, Path: "instances", Status: http.StatusServiceUnavailable})
+
+	if _, err := client.ListInstances(context.Background()); err == nil {
+		t.Fatal("expected the injected error")
+	}
+	if _, err := client.ListInstances(context.Background()); err != nil {
+		t.Fatalf("error was cached: %s", err)
+	}
+}
+
+func TestListCacheInvalidationSkipsInFlightReads(t *testing.T) {
+	var mu sync.Mutex
+	keys := 0
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mu.Lock()
+			keys++
+			mu.Unlock()
+			fmt.Fprint(w, `{"data":{}}`)
+			return
+		}
+		mu.Lock()
+		n := keys
+		mu.Unlock()
+		first := false
+		once.Do(func() { first = true })
+		if first {
+			// The first listing is answered with what it saw before the
+			// mutation below, once the mutation is done.
+			close(started)
+			<-release
+		}
+		list := make([]SSHKey, n)
+		for i := range list {
+			list[i] = SSHKey{ID: fmt.Sprint(i), Name: fmt.Sprint("key-", i)}
+		}
+		_ = json.NewEncoder(w).Encode(SSHKeyListResponse{Data: list})
+	}))
+	defer srv.Close()
+	client := NewLambdaClient(LambdaClientConfig{APIKey: "mock", Endpoint: srv.URL})
+	ctx := context.Background()
+
+	go func() { _, _ = client.ListSSHKeys(ctx) }()
+	<-started
+	res, err := client.MakeAPICall(ctx, http.MethodPost, "ssh-keys", SSHKeyCreateRequest{Name: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	result := make(chan []SSHKey, 1)
+	go func() {
+		list, _ := client.ListSSHKeys(ctx)
+		result <- list
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if list := <-result; len(list) != 1 {
+		t.Fatalf("a read after the mutation got the listing from before it: %v", list)
+	}
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// capacityPollInterval is how often the instance type catalog is checked
+// while waiting for capacity.
+const capacityPollInterval = 30 * time.Second
+
+// GetCapacity fetches the instance type catalog, bypassing the listing cache
+// so that polls observe capacity changes.
+func (c *LambdaClient) GetCapacity(ctx context.Context) (map[string]InstanceTypeAvailability, error) {
+	res, err := c.MakeAPICall(ctx, http.MethodGet, "instance-types", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, readAPIError(res)
+	}
+	var respData InstanceTypesAPIResponse
+	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
+
+// hasCapacity reports whether the catalog lists region as having capacity for
+// instanceType.
+func hasCapacity(catalog map[string]InstanceTypeAvailability, instanceType, region string) bool {
+	for _, r := range catalog[instanceType].RegionsWithCapacityAvailable {
+		if r.Name == region {
+			return true
+		}
+	}
+	return false
+}
+
+func isInsufficientCapacity(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == errCodeInsufficientCapacity
+}
+
+// WaitForCapacity polls the instance type catalog until region has capacity
+// for instanceType, or ctx is done. The first check happens one poll interval
+// in, callers wait after a launch already found no capacity.
+func (c *LambdaClient) WaitForCapacity(ctx context.Context, instanceType, region string) error {
+	for {
+		select {
+		case <-time.After(c.capacityPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		catalog, err := c.GetCapacity(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return err
+		}
+		if _, ok := catalog[instanceType]; !ok {
+			return fmt.Errorf("unknown instance type %q", instanceType)
+		}
+		if hasCapacity(catalog, instanceType, region) {
+			return nil
+		}
+		tflog.Debug(ctx, "waiting for capacity", map[string]interface{}{
+			"instance_type_name": instanceType,
+			"region_name":        region,
+		})
+	}
+}
+
+// LaunchInstanceWhenAvailable launches an instance like LaunchInstance, but
+// when the launch fails for lack of capacity it waits for capacity in the
+// requested region and tries again, until timeout has passed. It returns the
+// number of launch attempts made, and the last launch error when capacity
+// never showed up. Only the waits are bounded by timeout, a launch in flight
+// is never cut short.
+func (c *LambdaClient) LaunchInstanceWhenAvailable(ctx context.Context, req InstanceCreateAPIRequest, timeout time.Duration) (string, int, error) {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		id, err := c.LaunchInstance(ctx, req)
+		if err == nil || timeout <= 0 || !isInsufficientCapacity(err) {
+			return id, attempt, err
+		}
+		tflog.Info(ctx, "insufficient capacity, waiting for capacity to retry the launch", map[string]interface{}{
+			"instance_type_name": req.InstanceTypeName,
+			"region_name":        req.RegionName,
+			"attempt":            attempt,
+			"remaining":          time.Until(deadline).Round(time.Second).String(),
+		})
+		waitCtx, cancel := context.WithDeadline(ctx, deadline)
+		waitErr := c.WaitForCapacity(waitCtx, req.InstanceTypeName, req.RegionName)
+		cancel()
+		switch {
+		case errors.Is(waitErr, context.DeadlineExceeded) && ctx.Err() == nil:
+			return "", attempt, err
+		case waitErr != nil:
+			return "", attempt, waitErr
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &CapacityDataSource{}
+
+func NewCapacityDataSource() datasource.DataSource {
+	return &CapacityDataSource{}
+}
+
+type CapacityDataSource struct {
+	client *LambdaClient
+}
+
+type CapacityDataSourceModel struct {
+	InstanceTypeNames types.List      `tfsdk:"instance_type_names"`
+	RegionNames       types.List      `tfsdk:"region_names"`
+	WaitTimeout       types.String    `tfsdk:"wait_timeout"`
+	PollInterval      types.String    `tfsdk:"poll_interval"`
+	Id                types.String    `tfsdk:"id"`
+	Available         types.Bool      `tfsdk:"available"`
+	Capacity          []CapacityModel `tfsdk:"capacity"`
+}
+
+type CapacityModel struct {
+	InstanceTypeName  types.String `tfsdk:"instance_type_name"`
+	RegionName        types.String `tfsdk:"region_name"`
+	PriceCentsPerHour types.Int64  `tfsdk:"price_cents_per_hour"`
+}
+
+func (d *CapacityDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_capacity"
+}
+
+func (d *CapacityDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Instance type and region combinations that currently have capacity, optionally waiting until one does",
+
+		Attributes: map[string]schema.Attribute{
+			"instance_type_names": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Instance types to check, all instance types when unset",
+			},
+			"region_names": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Regions to check, all regions when unset",
+			},
+			"wait_timeout": schema.StringAttribute{
+				Optional:    true,
+				Description: "Wait up to this long, e.g. 30m, until at least one combination has capacity, failing when none does in time",
+			},
+			"poll_interval": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("How often to check for capacity while waiting, defaults to %s", capacityPollInterval),
+			},
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "First combination with capacity as <instance type>/<region>, empty when none has capacity",
+			},
+			"available": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether any combination has capacity",
+			},
+			"capacity": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Combinations with capacity, ordered by instance type and region",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"instance_type_name": schema.StringAttribute{
+							Computed:    true,
+							Description: "Name of the instance type",
+						},
+						"region_name": schema.StringAttribute{
+							Computed:    true,
+							Description: "Short name of the region",
+						},
+						"price_cents_per_hour": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Hourly price of the instance type in US cents",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *CapacityDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*LambdaClient)
+
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *LambdaClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	d.client = client
+}
+
+func (d *CapacityDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data CapacityDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var instanceTypes, regions []string
+	if !data.InstanceTypeNames.IsNull() {
+		resp.Diagnostics.Append(data.InstanceTypeNames.ElementsAs(ctx, &instanceTypes, false)...)
+	}
+	if !data.RegionNames.IsNull() {
+		resp.Diagnostics.Append(data.RegionNames.ElementsAs(ctx, &regions, false)...)
+	}
+	var timeout time.Duration
+	if !data.WaitTimeout.IsNull() {
+		var err error
+		if timeout, err = time.ParseDuration(data.WaitTimeout.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("wait_timeout"), "Invalid wait_timeout", err.Error())
+		}
+	}
+	interval := d.client.capacityPollInterval
+	if !data.PollInterval.IsNull() {
+		var err error
+		if interval, err = time.ParseDuration(data.PollInterval.ValueString()); err != nil || interval <= 0 {
+			resp.Diagnostics.AddAttributeError(path.Root("poll_interval"), "Invalid poll_interval", "Expected a positive duration such as 30s.")
+		}
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Only the sleeps between checks are bounded by the timeout, so running
+	// out of time is reported as such rather than as a failed request.
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var matches []CapacityModel
+	for {
+		catalog, err := d.client.GetCapacity(ctx)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Unable to list instance types", err)
+			return
+		}
+		for _, name := range instanceTypes {
+			if _, ok := catalog[name]; !ok {
+				resp.Diagnostics.AddAttributeError(path.Root("instance_type_names"), "Unknown instance type",
+					fmt.Sprintf("Instance type %q does not exist.", name))
+			}
+		}
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		matches = matchCapacity(catalog, instanceTypes, regions)
+		if len(matches) > 0 || timeout <= 0 {
+			break
+		}
+		tflog.Info(ctx, "waiting for capacity", map[string]interface{}{
+			"instance_type_names": instanceTypes,
+			"region_names":        regions,
+		})
+		select {
+		case <-time.After(interval):
+		case <-waitCtx.Done():
+			resp.Diagnostics.AddError("No capacity", fmt.Sprintf("No capacity for %s in %s became available within %s.",
+				describeNames("any instance type", instanceTypes), describeNames("any region", regions), timeout))
+			return
+		}
+	}
+
+	data.Id = types.StringValue("")
+	if len(matches) > 0 {
+		data.Id = types.StringValue(matches[0].InstanceTypeName.ValueString() + "/" + matches[0].RegionName.ValueString())
+	}
+	data.Available = types.BoolValue(len(matches) > 0)
+	data.Capacity = matches
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// matchCapacity lists the combinations of instanceTypes and regions the
+// catalog has capacity for, ordered by instance type and region. Empty
+// filters match everything.
+func matchCapacity(catalog map[string]InstanceTypeAvailability, instanceTypes, regions []string) []CapacityModel {
+	wanted := func(filter []string, name string) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, f := range filter {
+			if f == name {
+				return true
+			}
+		}
+		return false
+	}
+	matches := []CapacityModel{}
+	for name, availability := range catalog {
+		if !wanted(instanceTypes, name) {
+			continue
+		}
+		for _, region := range availability.RegionsWithCapacityAvailable {
+			if !wanted(regions, region.Name) {
+				continue
+			}
+			matches = append(matches, CapacityModel{
+				InstanceTypeName:  types.StringValue(name),
+				RegionName:        types.StringValue(region.Name),
+				PriceCentsPerHour: types.Int64Value(int64(availability.InstanceType.PriceCentsHourly)),
+			})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.InstanceTypeName.ValueString() != b.InstanceTypeName.ValueString() {
+			return a.InstanceTypeName.ValueString() < b.InstanceTypeName.ValueString()
+		}
+		return a.RegionName.ValueString() < b.RegionName.ValueString()
+	})
+	return matches
+}
+
+func describeNames(all string, names []string) string {
+	if len(names) == 0 {
+		return all
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestCapacityDataSource_mock(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	for _, region := range []string{"us-west-1", "us-east-1", "europe-central-1"} {
+		srv.SetCapacity("gpu_8x_h100_sxm5", region, 0)
+		if region != "us-east-1" {
+			srv.SetCapacity("gpu_1x_a100", region, 0)
+		}
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_capacity" "all" {}
+
+data "lambdalabs_capacity" "a100" {
+  instance_type_names = ["gpu_1x_a100"]
+}
+
+data "lambdalabs_capacity" "a100_west" {
+  instance_type_names = ["gpu_1x_a100"]
+  region_names        = ["us-west-1"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.all", "available", "true"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.all", "capacity.#", "4"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.all", "id", "gpu_1x_a10/europe-central-1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100", "capacity.#", "1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100", "capacity.0.region_name", "us-east-1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100", "capacity.0.price_cents_per_hour", "129"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100_west", "available", "false"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100_west", "capacity.#", "0"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.a100_west", "id", ""),
+				),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_capacity" "test" {
+  instance_type_names = ["gpu_1x_b200"]
+}
+`,
+				ExpectError: regexp.MustCompile("Unknown instance type"),
+			},
+		},
+	})
+}
+
+func TestCapacityDataSource_mockWait(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_8x_h100_sxm5", "us-east-1", 0)
+	time.AfterFunc(500*time.Millisecond, func() { srv.SetCapacity("gpu_8x_h100_sxm5", "us-east-1", 1) })
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_capacity" "test" {
+  instance_type_names = ["gpu_8x_h100_sxm5"]
+  region_names        = ["us-east-1"]
+  wait_timeout        = "1m"
+  poll_interval       = "50ms"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.test", "available", "true"),
+					resource.TestCheckResourceAttr("data.lambdalabs_capacity.test", "id", "gpu_8x_h100_sxm5/us-east-1"),
+				),
+			},
+		},
+	})
+}
+
+func TestCapacityDataSource_mockWaitTimeout(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_8x_h100_sxm5", "us-east-1", 0)
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_capacity" "test" {
+  instance_type_names = ["gpu_8x_h100_sxm5"]
+  region_names        = ["us-east-1"]
+  wait_timeout        = "200ms"
+  poll_interval       = "50ms"
+}
+`,
+				ExpectError: regexp.MustCompile("No capacity"),
+			},
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func TestLaunchInstanceWhenAvailable(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	client.capacityPollInterval = 10 * time.Millisecond
+	req := testMockLaunchRequest()
+	time.AfterFunc(100*time.Millisecond, func() { srv.SetCapacity("gpu_1x_a10", "us-west-1", 1) })
+
+	id, attempts, err := client.LaunchInstanceWhenAvailable(context.Background(), req, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.Instance(id); !ok {
+		t.Errorf("expected instance %s to be launched", id)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 launch attempts, got %d", attempts)
+	}
+	if n := srv.RequestCount(http.MethodGet, "instance-types"); n == 0 {
+		t.Error("expected capacity to be polled")
+	}
+}
+
+func TestLaunchInstanceWhenAvailableTimeout(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	client.capacityPollInterval = 10 * time.Millisecond
+	req := testMockLaunchRequest()
+
+	_, attempts, err := client.LaunchInstanceWhenAvailable(context.Background(), req, 50*time.Millisecond)
+	if !isInsufficientCapacity(err) {
+		t.Fatalf("expected the insufficient capacity error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 launch attempt, got %d", attempts)
+	}
+	if n := len(srv.Instances()); n != 0 {
+		t.Errorf("expected no instances, got %d", n)
+	}
+}
+
+func TestLaunchInstanceWhenAvailableNoWait(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	client.capacityPollInterval = 10 * time.Millisecond
+	req := testMockLaunchRequest()
+
+	_, attempts, err := client.LaunchInstanceWhenAvailable(context.Background(), req, 0)
+	if !isInsufficientCapacity(err) {
+		t.Fatalf("expected the insufficient capacity error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 launch attempt, got %d", attempts)
+	}
+	if n := srv.RequestCount(http.MethodGet, "instance-types"); n != 0 {
+		t.Errorf("expected no capacity polls, got %d", n)
+	}
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// Error codes returned by the Lambda API.
+const (
+	errCodeInvalidAPIKey        = "global/invalid-api-key"
+	errCodeAccountInactive      = "global/account-inactive"
+	errCodeInvalidParameters    = "global/invalid-parameters"
+	errCodeNotFound             = "global/object-does-not-exist"
+	errCodeQuotaExceeded        = "global/quota-exceeded"
+	errCodeInsufficientCapacity = "instance-operations/launch/insufficient-capacity"
+)
+
+var errCodeSummaries = map[string]string{
+	errCodeInvalidAPIKey:        "Invalid Lambda API key",
+	errCodeAccountInactive:      "Lambda account inactive",
+	errCodeInvalidParameters:    "Invalid parameters",
+	errCodeNotFound:             "Object not found",
+	errCodeQuotaExceeded:        "Quota exceeded",
+	errCodeInsufficientCapacity: "Insufficient capacity",
+}
+
+// requestIDHeaders are the headers checked, in order, for the id of the
+// failed request.
+var requestIDHeaders = []string{"X-Request-Id", "Request-Id", "X-Amzn-Requestid"}
+
+// maxErrorBodyLength caps how much of a non JSON error body ends up in a
+// diagnostic, gateways like to return whole HTML pages.
+const maxErrorBodyLength = 512
+
+// APIError is an unsuccessful response from the Lambda API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	RequestID  string
+	Code       string
+	Message    string
+	Suggestion string
+}
+
+// readAPIError builds an APIError from a response, consuming its body. Bodies
+// that are not the documented JSON error are kept as the message.
+func readAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
+	for _, header := range requestIDHeaders {
+		if id := res.Header.Get(header); id != "" {
+			apiErr.RequestID = id
+			break
+		}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		apiErr.Message = fmt.Sprintf("reading error response: %s", err)
+		return apiErr
+	}
+	var errData InstanceAPIErrorResponse
+	if err := json.Unmarshal(raw, &errData); err == nil && errData.Error.Message != "" {
+		apiErr.Code = errData.Error.Code
+		apiErr.Message = errData.Error.Message
+		if errData.Error.Suggestion != nil {
+			apiErr.Suggestion = *errData.Error.Suggestion
+		}
+		return apiErr
+	}
+
+	body := strings.TrimSpace(string(raw))
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength] + "..."
+	}
+	if body == "" {
+		body = "empty response body"
+	}
+	apiErr.Message = fmt.Sprintf("unexpected response: %s", body)
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// Summary is a short description of the failure, specific for the error
+// codes users can act on.
+func (e *APIError) Summary() string {
+	if summary, ok := errCodeSummaries[e.Code]; ok {
+		return summary
+	}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return errCodeSummaries[errCodeInvalidAPIKey]
+	case e.StatusCode == http.StatusNotFound:
+		return errCodeSummaries[errCodeNotFound]
+	case e.StatusCode == http.StatusTooManyRequests:
+		return "Lambda API rate limit exceeded"
+	case e.StatusCode >= http.StatusInternalServerError:
+		return "Lambda API unavailable"
+	}
+	return "Lambda API error"
+}
+
+// Detail describes what was attempted, the API message and suggestion, and
+// the identifiers needed when contacting Lambda support.
+func (e *APIError) Detail(action string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", action, e.Message)
+	if e.Suggestion != "" {
+		fmt.Fprintf(&b, "\n\nSuggestion: %s", e.Suggestion)
+	}
+	fmt.Fprintf(&b, "\n\nHTTP status: %s", e.Status)
+	if e.Code != "" {
+		fmt.Fprintf(&b, "\nError code: %s", e.Code)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, "\nRequest ID: %s", e.RequestID)
+	}
+	return b.String()
+}
+
+// addAPIErrorDiagnostic reports a failed API response as an error diagnostic.
+func addAPIErrorDiagnostic(diags *diag.Diagnostics, action string, res *http.Response) {
+	apiErr := readAPIError(res)
+	diags.AddError(apiErr.Summary(), apiErr.Detail(action))
+}
+
+// addErrorDiagnostic reports an error returned by a client helper, API errors
+// get the same treatment as addAPIErrorDiagnostic.
+func addErrorDiagnostic(diags *diag.Diagnostics, action string, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		diags.AddError(apiErr.Summary(), apiErr.Detail(action))
+		return
+	}
+	diags.AddError("Client Error", fmt.Sprintf("%s, got error: %s", action, err))
+}
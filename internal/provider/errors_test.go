@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testErrorResponse(status int, contentType, body string) *http.Response {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", contentType)
+	rec.Header().Set("X-Request-Id", "req-123")
+	rec.WriteHeader(status)
+	_, _ = rec.WriteString(body)
+	return rec.Result()
+}
+
+func TestReadAPIError(t *testing.T) {
+	res := testErrorResponse(http.StatusBadRequest, "application/json", `{"error":{"code":"instance-operations/launch/insufficient-capacity","message":"Not enough capacity to fulfill launch request.","suggestion":"Try again later."}}`)
+	apiErr := readAPIError(res)
+
+	if got := apiErr.Summary(); got != "Insufficient capacity" {
+		t.Errorf("Summary() = %q", got)
+	}
+	detail := apiErr.Detail("Unable to launch instance")
+	for _, want := range []string{
+		"Unable to launch instance: Not enough capacity to fulfill launch request.",
+		"Suggestion: Try again later.",
+		"HTTP status: 400 Bad Request",
+		"Error code: instance-operations/launch/insufficient-capacity",
+		"Request ID: req-123",
+	} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("Detail() is missing %q:\n%s", want, detail)
+		}
+	}
+}
+
+func TestReadAPIErrorNonJSON(t *testing.T) {
+	res := testErrorResponse(http.StatusBadGateway, "text/html", "<html>"+strings.Repeat("x", 2*maxErrorBodyLength)+"</html>")
+	apiErr := readAPIError(res)
+
+	if got := apiErr.Summary(); got != "Lambda API unavailable" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if !strings.HasPrefix(apiErr.Message, "unexpected response: <html>") || len(apiErr.Message) > maxErrorBodyLength+64 {
+		t.Errorf("unexpected message %q", apiErr.Message)
+	}
+}
+
+func TestAPIErrorSummaryFromStatus(t *testing.T) {
+	cases := map[int]string{
+		http.StatusUnauthorized:    "Invalid Lambda API key",
+		http.StatusNotFound:        "Object not found",
+		http.StatusTooManyRequests: "Lambda API rate limit exceeded",
+		http.StatusConflict:        "Lambda API error",
+	}
+	for status, want := range cases {
+		if got := readAPIError(testErrorResponse(status, "text/plain", "")).Summary(); got != want {
+			t.Errorf("status %d: Summary() = %q, want %q", status, got, want)
+		}
+	}
+}
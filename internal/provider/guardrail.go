@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// spendGuardrail caps the instances and hourly spend of the account. Every
+// instance planned by the running Terraform command is counted on top of the
+// instances already running, until its launch makes it show up in the
+// instance listing.
+type spendGuardrail struct {
+	// maxHourlyCents and maxInstances are ignored when negative.
+	maxHourlyCents int
+	maxInstances   int
+
+	mu           sync.Mutex
+	pendingCents int
+	pendingCount int
+	// replaced holds instances planned to be replaced, their spend is taken
+	// over by the replacement.
+	replaced map[string]bool
+}
+
+func newSpendGuardrail(maxHourlyCents, maxInstances int) *spendGuardrail {
+	if maxHourlyCents < 0 && maxInstances < 0 {
+		return nil
+	}
+	return &spendGuardrail{
+		maxHourlyCents: maxHourlyCents,
+		maxInstances:   maxInstances,
+		replaced:       map[string]bool{},
+	}
+}
+
+// reserve accounts for a planned instance costing priceCents per hour,
+// replacing the instance replacedID when not empty, and fails when the
+// account would exceed a limit.
+func (g *spendGuardrail) reserve(ctx context.Context, client *LambdaClient, priceCents int, replacedID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	instances, err := client.ListInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list running instances: %w", err)
+	}
+	spend, count := g.pendingCents+priceCents, g.pendingCount+1
+	for _, instance := range instances {
+		if instance.Status == instanceStatusTerminated || g.replaced[instance.Id] || instance.Id == replacedID {
+			continue
+		}
+		spend += instance.InstanceType.PriceCentsHourly
+		count++
+	}
+
+	if g.maxInstances >= 0 && count > g.maxInstances {
+		return fmt.Errorf("this plan would run %d instances, more than max_instances = %d", count, g.maxInstances)
+	}
+	if g.maxHourlyCents >= 0 && spend > g.maxHourlyCents {
+		return fmt.Errorf("this plan would spend %s/hour, more than max_hourly_spend_cents = %d (%s/hour)",
+			formatCents(spend), g.maxHourlyCents, formatCents(g.maxHourlyCents))
+	}
+	g.pendingCents += priceCents
+	g.pendingCount++
+	if replacedID != "" {
+		g.replaced[replacedID] = true
+	}
+	return nil
+}
+
+// release drops the reservation of a planned instance once its launch is
+// over, a launched instance is counted from the instance listing instead.
+func (g *spendGuardrail) release(priceCents int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pendingCount == 0 {
+		return
+	}
+	g.pendingCents -= priceCents
+	g.pendingCount--
+	if g.pendingCents < 0 {
+		g.pendingCents = 0
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func TestSpendGuardrail(t *testing.T) {
+	client, _ := testMockClient(t, lambdamock.Options{})
+	ctx := context.Background()
+	req := testMockLaunchRequest()
+	req.InstanceTypeName = "gpu_1x_a100"
+	running, err := client.LaunchInstance(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 129 running plus 75 planned leaves no room for another 75 under 250.
+	spend := newSpendGuardrail(250, -1)
+	if err := spend.reserve(ctx, client, 75, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := spend.reserve(ctx, client, 75, ""); err == nil || !strings.Contains(err.Error(), "max_hourly_spend_cents") {
+		t.Fatalf("expected the spend limit to be hit, got %v", err)
+	}
+	// Replacing the running instance frees its spend.
+	if err := spend.reserve(ctx, client, 75, running); err != nil {
+		t.Fatal(err)
+	}
+	spend.release(75)
+	if spend.pendingCount != 1 || spend.pendingCents != 75 {
+		t.Errorf("release did not drop a reservation: %d instances, %d cents", spend.pendingCount, spend.pendingCents)
+	}
+
+	count := newSpendGuardrail(-1, 2)
+	if err := count.reserve(ctx, client, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := count.reserve(ctx, client, 0, ""); err == nil || !strings.Contains(err.Error(), "max_instances") {
+		t.Fatalf("expected the instance limit to be hit, got %v", err)
+	}
+}
+
+func TestSpendGuardrailReleasesFailedLaunch(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	ctx := context.Background()
+	guardrail := newSpendGuardrail(-1, 1)
+
+	if err := guardrail.reserve(ctx, client, 75, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.LaunchInstance(ctx, testMockLaunchRequest()); err == nil {
+		t.Fatal("expected the launch to fail")
+	}
+	// As the create of the instance does once the launch is over.
+	guardrail.release(75)
+	if err := guardrail.reserve(ctx, client, 75, ""); err != nil {
+		t.Fatalf("the failed launch still counts against max_instances: %v", err)
+	}
+}
+
+func TestSpendGuardrailDisabled(t *testing.T) {
+	if g := newSpendGuardrail(-1, -1); g != nil {
+		t.Errorf("expected no guardrail without limits, got %+v", g)
+	}
+}
@@ -6,10 +6,125 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func MakeAPICall(ctx context.Context, apiKey, method, url string, data interface{}) (*http.Response, error) {
+const defaultEndpoint = "https://cloud.lambdalabs.com/api/v1"
+
+// LambdaClient is the provider data handed to every resource and data source.
+type LambdaClient struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+	cache      *listCache
+	claims     *launchClaims
+	batcher    *launchBatcher
+	guardrail  *spendGuardrail
+	policy     *launchPolicy
+	// defaultTags are merged into the tags of every instance.
+	defaultTags map[string]string
+	// defaultRegion and defaultSSHKeyNames are used for instances that do
+	// not set their own.
+	defaultRegion      string
+	defaultSSHKeyNames []string
+
+	orphanSearchAttempts int
+	orphanSearchInterval time.Duration
+	instancePollInterval time.Duration
+	capacityPollInterval time.Duration
+
+	dialSSH          sshDialFunc
+	sshRetryInterval time.Duration
+}
+
+// LambdaClientConfig holds the settings a LambdaClient is built from.
+type LambdaClientConfig struct {
+	APIKey   string
+	Endpoint string
+	// HTTPClient is used to reach the API, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// MaxConcurrentRequests and RequestsPerSecond limit the traffic of every
+	// resource and data source sharing the client, zero disables a limit.
+	MaxConcurrentRequests int
+	RequestsPerSecond     float64
+	// LaunchBatchWindow, when positive, is how long a launch waits for
+	// identical launches to send them as one request.
+	LaunchBatchWindow time.Duration
+	// MaxHourlySpendCents and MaxInstances cap the running and planned
+	// instances of the account, nil leaves them unlimited.
+	MaxHourlySpendCents *int
+	MaxInstances        *int
+	// AllowedRegions, AllowedInstanceTypes and DeniedInstanceTypes are
+	// path.Match patterns restricting launches, nil allow lists allow
+	// everything.
+	AllowedRegions       []string
+	AllowedInstanceTypes []string
+	DeniedInstanceTypes  []string
+	// DefaultTags are merged into the tags of every instance.
+	DefaultTags map[string]string
+	// DefaultRegion and DefaultSSHKeyNames are used for instances that do
+	// not set their own.
+	DefaultRegion      string
+	DefaultSSHKeyNames []string
+	// DialSSH opens the connections used to reach instances over SSH,
+	// defaults to a net.Dialer.
+	DialSSH sshDialFunc
+}
+
+func NewLambdaClient(config LambdaClientConfig) *LambdaClient {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	client := &http.Client{}
+	if config.HTTPClient != nil {
+		*client = *config.HTTPClient
+	}
+	client.Transport = newLimitTransport(
+		config.MaxConcurrentRequests,
+		config.RequestsPerSecond,
+		newLoggingTransport(config.APIKey, client.Transport),
+	)
+	c := &LambdaClient{
+		apiKey:     config.APIKey,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: client,
+		cache:      newListCache(listCacheTTL),
+		claims:     newLaunchClaims(),
+
+		orphanSearchAttempts: orphanSearchAttempts,
+		orphanSearchInterval: orphanSearchInterval,
+		instancePollInterval: instancePollInterval,
+		capacityPollInterval: capacityPollInterval,
+
+		dialSSH:          config.DialSSH,
+		sshRetryInterval: sshRetryInterval,
+	}
+	if c.dialSSH == nil {
+		c.dialSSH = (&net.Dialer{}).DialContext
+	}
+	maxHourlyCents, maxInstances := -1, -1
+	if config.MaxHourlySpendCents != nil {
+		maxHourlyCents = *config.MaxHourlySpendCents
+	}
+	if config.MaxInstances != nil {
+		maxInstances = *config.MaxInstances
+	}
+	c.guardrail = newSpendGuardrail(maxHourlyCents, maxInstances)
+	c.defaultTags = config.DefaultTags
+	c.defaultRegion = config.DefaultRegion
+	c.defaultSSHKeyNames = config.DefaultSSHKeyNames
+	c.policy = newLaunchPolicy(config.AllowedRegions, config.AllowedInstanceTypes, config.DeniedInstanceTypes)
+	if config.LaunchBatchWindow > 0 {
+		c.batcher = newLaunchBatcher(config.LaunchBatchWindow, c.LaunchInstances)
+	}
+	return c
+}
+
+func (c *LambdaClient) MakeAPICall(ctx context.Context, method, url string, data interface{}) (*http.Response, error) {
 	var reader io.Reader
 	if data != nil {
 		raw, err := json.Marshal(data)
@@ -18,12 +133,20 @@ func MakeAPICall(ctx context.Context, apiKey, method, url string, data interface
 		}
 		reader = bytes.NewReader(raw)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("https://cloud.lambdalabs.com/api/v1/%s", url), reader)
-	httpReq.SetBasicAuth(apiKey, "")
+	httpReq, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", c.endpoint, url), reader)
 	if err != nil {
 		return nil, err
 	}
+	httpReq.SetBasicAuth(c.apiKey, "")
+	if data != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
 
-	return http.DefaultClient.Do(httpReq)
-
+	res, err := c.httpClient.Do(httpReq)
+	if method != http.MethodGet {
+		// Even failed mutations may have changed something, drop every cached
+		// list so the next read sees it.
+		c.cache.invalidate()
+	}
+	return res, err
 }
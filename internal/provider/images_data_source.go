@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &ImagesDataSource{}
+
+func NewImagesDataSource() datasource.DataSource {
+	return &ImagesDataSource{}
+}
+
+type ImagesDataSource struct {
+	client *LambdaClient
+}
+
+type ImagesDataSourceModel struct {
+	Family       types.String `tfsdk:"family"`
+	NameRegex    types.String `tfsdk:"name_regex"`
+	Architecture types.String `tfsdk:"architecture"`
+	RegionName   types.String `tfsdk:"region_name"`
+	MostRecent   types.Bool   `tfsdk:"most_recent"`
+	Id           types.String `tfsdk:"id"`
+	Images       []ImageModel `tfsdk:"images"`
+}
+
+type ImageModel struct {
+	Id           types.String `tfsdk:"id"`
+	Name         types.String `tfsdk:"name"`
+	Family       types.String `tfsdk:"family"`
+	Version      types.String `tfsdk:"version"`
+	Architecture types.String `tfsdk:"architecture"`
+	RegionName   types.String `tfsdk:"region_name"`
+	CreatedTime  types.String `tfsdk:"created_time"`
+}
+
+type ImageAPI struct {
+	Id           string `json:"id"`
+	CreatedTime  string `json:"created_time"`
+	UpdatedTime  string `json:"updated_time"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Family       string `json:"family"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Region       Region `json:"region"`
+}
+
+type ImageListAPIResponse struct {
+	Data []ImageAPI `json:"data"`
+}
+
+// ListImages returns the machine images available to the account.
+func (c *LambdaClient) ListImages(ctx context.Context) ([]ImageAPI, error) {
+	var respData ImageListAPIResponse
+	if err := c.cachedGet(ctx, "images", &respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
+
+func (d *ImagesDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_images"
+}
+
+func (d *ImagesDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Machine images instances can be launched from, newest first",
+
+		Attributes: map[string]schema.Attribute{
+			"family": schema.StringAttribute{
+				Optional:    true,
+				Description: "Only list images of this family",
+			},
+			"name_regex": schema.StringAttribute{
+				Optional:    true,
+				Description: "Only list images whose name matches this regular expression",
+			},
+			"architecture": schema.StringAttribute{
+				Optional:    true,
+				Description: "Only list images for this CPU architecture, e.g. x86_64 or arm64",
+			},
+			"region_name": schema.StringAttribute{
+				Optional:    true,
+				Description: "Only list images available in this region",
+			},
+			"most_recent": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Only keep the newest matching image, failing when nothing matches",
+			},
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "id of the newest matching image, empty when nothing matches",
+			},
+			"images": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Matching images, newest first",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.StringAttribute{
+							Computed:    true,
+							Description: "id of the image",
+						},
+						"name": schema.StringAttribute{
+							Computed:    true,
+							Description: "Name of the image",
+						},
+						"family": schema.StringAttribute{
+							Computed:    true,
+							Description: "Family of the image",
+						},
+						"version": schema.StringAttribute{
+							Computed:    true,
+							Description: "Version of the image within its family",
+						},
+						"architecture": schema.StringAttribute{
+							Computed:    true,
+							Description: "CPU architecture of the image",
+						},
+						"region_name": schema.StringAttribute{
+							Computed:    true,
+							Description: "Region the image is available in",
+						},
+						"created_time": schema.StringAttribute{
+							Computed:    true,
+							Description: "When the image was created, in RFC 3339 format",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *ImagesDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*LambdaClient)
+
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *LambdaClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	d.client = client
+}
+
+func (d *ImagesDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data ImagesDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var nameRegex *regexp.Regexp
+	if !data.NameRegex.IsNull() {
+		var err error
+		nameRegex, err = regexp.Compile(data.NameRegex.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("name_regex"), "Invalid name_regex", err.Error())
+			return
+		}
+	}
+
+	images, err := d.client.ListImages(ctx)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to list images", err)
+		return
+	}
+
+	var matches []ImageAPI
+	for _, image := range images {
+		if (!data.Family.IsNull() && image.Family != data.Family.ValueString()) ||
+			(!data.Architecture.IsNull() && image.Architecture != data.Architecture.ValueString()) ||
+			(!data.RegionName.IsNull() && image.Region.Name != data.RegionName.ValueString()) ||
+			(nameRegex != nil && !nameRegex.MatchString(image.Name)) {
+			continue
+		}
+		matches = append(matches, image)
+	}
+	sortImagesNewestFirst(matches)
+
+	if data.MostRecent.ValueBool() {
+		if len(matches) == 0 {
+			resp.Diagnostics.AddError("No matching image", "No image matches the given filters, so there is no most recent one.")
+			return
+		}
+		matches = matches[:1]
+	}
+
+	data.Id = types.StringValue("")
+	if len(matches) > 0 {
+		data.Id = types.StringValue(matches[0].Id)
+	}
+	data.Images = make([]ImageModel, len(matches))
+	for i, image := range matches {
+		data.Images[i] = ImageModel{
+			Id:           types.StringValue(image.Id),
+			Name:         types.StringValue(image.Name),
+			Family:       types.StringValue(image.Family),
+			Version:      types.StringValue(image.Version),
+			Architecture: types.StringValue(image.Architecture),
+			RegionName:   types.StringValue(image.Region.Name),
+			CreatedTime:  types.StringValue(image.CreatedTime),
+		}
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// sortImagesNewestFirst orders images by creation time, newest first, with ids
+// breaking ties so the order is stable across reads.
+func sortImagesNewestFirst(images []ImageAPI) {
+	created := func(image ImageAPI) time.Time {
+		t, _ := time.Parse(time.RFC3339, image.CreatedTime)
+		return t
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		ti, tj := created(images[i]), created(images[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return images[i].Id < images[j].Id
+	})
+}
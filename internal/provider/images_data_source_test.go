@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestImagesDataSource_mock(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_images" "all" {}
+
+data "lambdalabs_images" "stack" {
+  family      = "lambda-stack-22-04"
+  region_name = "us-west-1"
+}
+
+data "lambdalabs_images" "latest" {
+  family       = "lambda-stack-22-04"
+  architecture = "x86_64"
+  region_name  = "us-west-1"
+  most_recent  = true
+}
+
+data "lambdalabs_images" "arm" {
+  name_regex = "arm64$"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.lambdalabs_images.all", "images.#", "4"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.stack", "images.#", "2"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.stack", "images.0.id", "img-stack-2204-2"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.stack", "images.1.id", "img-stack-2204-1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.latest", "images.#", "1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.latest", "images.0.id", "img-stack-2204-2"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.latest", "images.0.version", "1.1.0"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.arm", "images.#", "1"),
+					resource.TestCheckResourceAttr("data.lambdalabs_images.arm", "images.0.architecture", "arm64"),
+				),
+			},
+		},
+	})
+}
+
+func TestImagesDataSource_mockNoMatch(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+data "lambdalabs_images" "none" {
+  family      = "windows"
+  most_recent = true
+}
+`,
+				ExpectError: regexp.MustCompile("No matching image"),
+			},
+		},
+	})
+}
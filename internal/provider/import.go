@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseImportID splits an import ID of the form "<kind>:<value>". Plain IDs
+// without a recognised prefix return an empty kind and are imported as is.
+func parseImportID(id string) (string, string) {
+	kind, value, found := strings.Cut(id, ":")
+	if !found || kind == "" || strings.ContainsAny(kind, " /") {
+		return "", id
+	}
+	return kind, value
+}
+
+// resolveImportID picks the single id matching an import lookup, erroring
+// when nothing or more than one object matched.
+func resolveImportID(object, kind, value string, ids []string) (string, error) {
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no %s found with %s %q", object, kind, value)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%d %ss found with %s %q (ids: %s), import by id instead", len(ids), object, kind, value, strings.Join(ids, ", "))
+	}
+}
@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestParseImportID(t *testing.T) {
+	cases := []struct {
+		id, kind, value string
+	}{
+		{"0920582c7ff041399e34823a0be62549", "", "0920582c7ff041399e34823a0be62549"},
+		{"name:training-box", "name", "training-box"},
+		{"name:with:colon", "name", "with:colon"},
+		{"ip:10.0.0.1", "ip", "10.0.0.1"},
+		{":empty", "", ":empty"},
+	}
+	for _, c := range cases {
+		kind, value := parseImportID(c.id)
+		if kind != c.kind || value != c.value {
+			t.Errorf("parseImportID(%q) = (%q, %q), want (%q, %q)", c.id, kind, value, c.kind, c.value)
+		}
+	}
+}
+
+func TestResolveImportID(t *testing.T) {
+	if _, err := resolveImportID("instance", "name", "a", nil); err == nil {
+		t.Error("expected an error when nothing matches")
+	}
+	if id, err := resolveImportID("instance", "name", "a", []string{"1"}); err != nil || id != "1" {
+		t.Errorf("got (%q, %v), want (\"1\", nil)", id, err)
+	}
+	if _, err := resolveImportID("instance", "name", "a", []string{"1", "2"}); err == nil {
+		t.Error("expected an error on ambiguous matches")
+	}
+}
@@ -3,28 +3,39 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure provider defined types fully satisfy framework interfaces.
 var _ resource.Resource = &InstanceResource{}
 var _ resource.ResourceWithImportState = &InstanceResource{}
+var _ resource.ResourceWithModifyPlan = &InstanceResource{}
+var _ resource.ResourceWithValidateConfig = &InstanceResource{}
 
 func NewInstanceResource() resource.Resource {
 	return &InstanceResource{}
 }
 
 type InstanceResource struct {
-	apiKey string
+	client *LambdaClient
 }
 
 type InstanceResourceModel struct {
@@ -33,10 +44,38 @@ type InstanceResourceModel struct {
 	SshKeyNames      types.List   `tfsdk:"ssh_key_names"`
 	FileSystemNames  types.List   `tfsdk:"file_system_names"`
 	// Quantity         types.Number `tfsdk:"quantity"`
-	Name   types.String `tfsdk:"name"`
-	IP     types.String `tfsdk:"ip"`
-	Status types.String `tfsdk:"status"`
+	Name       types.String `tfsdk:"name"`
+	NamePrefix types.String `tfsdk:"name_prefix"`
+	IP         types.String `tfsdk:"ip"`
+	Status     types.String `tfsdk:"status"`
+	Id         types.String `tfsdk:"id"`
+
+	ReplaceOnUnhealthy    types.Bool `tfsdk:"replace_on_unhealthy"`
+	TerminationProtection types.Bool `tfsdk:"termination_protection"`
+
+	PriceCentsPerHour types.Int64 `tfsdk:"price_cents_per_hour"`
+
+	UserData       types.String `tfsdk:"user_data"`
+	UserDataBase64 types.String `tfsdk:"user_data_base64"`
+	Image          types.Object `tfsdk:"image"`
+
+	Tags    types.Map `tfsdk:"tags"`
+	TagsAll types.Map `tfsdk:"tags_all"`
+
+	WaitForCapacityTimeout types.String `tfsdk:"wait_for_capacity_timeout"`
+	LaunchAttempts         types.Int64  `tfsdk:"launch_attempts"`
+
+	WaitForSSH        types.Bool   `tfsdk:"wait_for_ssh"`
+	SSHWaitTimeout    types.String `tfsdk:"ssh_wait_timeout"`
+	CaptureSSHHostKey types.Bool   `tfsdk:"capture_ssh_host_key"`
+	SSHHostKey        types.String `tfsdk:"ssh_host_key"`
+
+	Provisioning types.Object `tfsdk:"provisioning"`
+}
+
+type InstanceImageModel struct {
 	Id     types.String `tfsdk:"id"`
+	Family types.String `tfsdk:"family"`
 }
 
 type InstanceCreateAPIRequest struct {
@@ -44,8 +83,18 @@ type InstanceCreateAPIRequest struct {
 	InstanceTypeName string   `json:"instance_type_name"`
 	SSHKeyNames      []string `json:"ssh_key_names"`
 	FileSystemNames  []string `json:"file_system_names,omitempty"`
-	Quantity         int      `json:"Quantity"`
+	Quantity         int      `json:"quantity"`
 	Name             *string  `json:"name"`
+	UserData         string   `json:"user_data,omitempty"`
+	Image            *Image   `json:"image,omitempty"`
+	Tags             []Tag    `json:"tags,omitempty"`
+}
+
+// Image selects the image an instance boots, either a specific image or the
+// latest image of a family.
+type Image struct {
+	Id     string `json:"id,omitempty"`
+	Family string `json:"family,omitempty"`
 }
 
 type InstanceAPIErrorResponse struct {
@@ -63,31 +112,28 @@ type InstanceCreateAPIResponse struct {
 }
 
 type Instance struct {
-	Id              string   `json:"id"`
-	Name            string   `json:"name"`
-	IP              string   `json:"ip"`
-	Status          string   `json:"status"`
-	SshKeyNames     []string `json:"ssh_key_names"`
-	FileSystemNames []string `json:"file_system_names"`
-	Region          struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-	} `json:"region"`
-	InstanceType struct {
-		Name             string      `json:"name"`
-		Description      string      `json:"description"`
-		PriceCentsHourly int         `json:"price_cents_per_hour"`
-		Specs            interface{} `json:"specs"`
-	} `json:"instance_type"`
-	Hostname     string `json:"hostname"`
-	JupyterToken string `json:"jupyter_token"`
-	JupyterUrl   string `json:"jupyter_url"`
+	Id              string       `json:"id"`
+	Name            string       `json:"name"`
+	IP              string       `json:"ip"`
+	Status          string       `json:"status"`
+	SshKeyNames     []string     `json:"ssh_key_names"`
+	FileSystemNames []string     `json:"file_system_names"`
+	Region          Region       `json:"region"`
+	InstanceType    InstanceType `json:"instance_type"`
+	Hostname        string       `json:"hostname"`
+	JupyterToken    string       `json:"jupyter_token"`
+	JupyterUrl      string       `json:"jupyter_url"`
+	Tags            []Tag        `json:"tags"`
 }
 
 type InstanceGetAPIResponse struct {
 	Data Instance `json:"data"`
 }
 
+type InstanceListAPIResponse struct {
+	Data []Instance `json:"data"`
+}
+
 type InstanceDeleteApiRequest struct {
 	InstanceIds []string `json:"instance_ids"`
 }
@@ -109,17 +155,25 @@ func (r *InstanceResource) Schema(ctx context.Context, req resource.SchemaReques
 
 		Attributes: map[string]schema.Attribute{
 			"region_name": schema.StringAttribute{
-				Required:    true,
-				Description: "Short name of a region",
+				Optional:    true,
+				Computed:    true,
+				Description: "Short name of a region, defaults to the provider default_region",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"instance_type_name": schema.StringAttribute{
 				Required:    true,
 				Description: "Name of an instance type",
 			},
 			"ssh_key_names": schema.ListAttribute{
-				Required:    true,
+				Optional:    true,
+				Computed:    true,
 				ElementType: types.StringType,
-				Description: "Names of the SSH keys to allow access to the instances. Currently, exactly one SSH key must be specified.",
+				Description: "Names of the SSH keys to allow access to the instances, defaults to the provider default_ssh_key_names. Currently, exactly one SSH key must be specified.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"file_system_names": schema.ListAttribute{
 				Optional:    true,
@@ -133,7 +187,18 @@ func (r *InstanceResource) Schema(ctx context.Context, req resource.SchemaReques
 			// },
 			"name": schema.StringAttribute{
 				Optional:    true,
-				Description: "User-provided name for the instance",
+				Computed:    true,
+				Description: "User-provided name for the instance, generated when name_prefix is set",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name_prefix": schema.StringAttribute{
+				Optional:    true,
+				Description: "Creates a unique name beginning with this prefix, conflicts with name. Changing it replaces the instance.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"ip": schema.StringAttribute{
 				Computed:    true,
@@ -151,6 +216,98 @@ func (r *InstanceResource) Schema(ctx context.Context, req resource.SchemaReques
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"replace_on_unhealthy": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Plan a replacement when the instance is found unhealthy or terminated outside of Terraform",
+			},
+			"termination_protection": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Refuse to destroy or replace the instance until this is set to false in a separate apply",
+			},
+			"price_cents_per_hour": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Hourly price of the instance in US cents",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"user_data": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("cloud-init user data to boot the instance with, at most %d bytes. Changing it replaces the instance.", maxUserDataBytes),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"user_data_base64": schema.StringAttribute{
+				Optional: true,
+				Description: "Base64 encoded cloud-init user data, optionally gzip compressed as produced by the cloudinit_config data source. " +
+					"Conflicts with user_data. Changing it replaces the instance.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"image": schema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Image to boot the instance from instead of the default image. Changing it replaces the instance.",
+				Attributes: map[string]schema.Attribute{
+					"id": schema.StringAttribute{
+						Optional:    true,
+						Description: "id of the image, conflicts with family",
+					},
+					"family": schema.StringAttribute{
+						Optional:    true,
+						Description: "Family of the image, the latest image of the family is used. Conflicts with id",
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+			},
+			"tags": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Tags of the instance, merged over the provider default_tags. Tags can only be set at launch, changing them replaces the instance. Tags edited outside of Terraform are reported as a warning but not replaced.",
+			},
+			"tags_all": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Tags the instance has, including the provider default_tags it was launched with",
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"wait_for_capacity_timeout": schema.StringAttribute{
+				Optional: true,
+				Description: "How long to wait for capacity and retry when the launch fails for insufficient capacity in the region, e.g. 30m. " +
+					"Launches fail right away when unset",
+			},
+			"launch_attempts": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Number of launch attempts it took to launch the instance",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"wait_for_ssh": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Wait after launch until the instance accepts SSH connections, capturing its host key unless capture_ssh_host_key is false",
+			},
+			"ssh_wait_timeout": schema.StringAttribute{
+				Optional:    true,
+				Description: "How long wait_for_ssh waits, e.g. 10m, defaults to 5m. Requires wait_for_ssh",
+			},
+			"capture_ssh_host_key": schema.BoolAttribute{
+				Optional: true,
+				Description: "Whether wait_for_ssh completes an SSH key exchange to capture ssh_host_key, defaults to true. " +
+					"When false it only waits for the SSH port to accept TCP connections. Requires wait_for_ssh",
+			},
+			"ssh_host_key": schema.StringAttribute{
+				Computed:    true,
+				Description: "SSH host key of the instance in authorized_keys format, captured when wait_for_ssh is set and capture_ssh_host_key is not false",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
 			"id": schema.StringAttribute{
 				Computed:    true,
 				Description: "id of the instance",
@@ -159,6 +316,28 @@ func (r *InstanceResource) Schema(ctx context.Context, req resource.SchemaReques
 				},
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"provisioning": schema.SingleNestedBlock{
+				Description: "Commands run over SSH once the instance is active, a failing command fails the apply and taints the instance. " +
+					"The output of the commands is shown as a warning once they all succeed. Only run when the instance is launched",
+				Attributes: map[string]schema.Attribute{
+					"private_key": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "PEM encoded private key of one of the ssh_key_names, required",
+					},
+					"user": schema.StringAttribute{
+						Optional:    true,
+						Description: fmt.Sprintf("User to connect as, defaults to %s", defaultProvisioningUser),
+					},
+					"commands": schema.ListAttribute{
+						Optional:    true,
+						ElementType: types.StringType,
+						Description: "Commands to run in order, stopping at the first that exits non-zero",
+					},
+				},
+			},
+		},
 	}
 }
 
@@ -168,18 +347,18 @@ func (r *InstanceResource) Configure(ctx context.Context, req resource.Configure
 		return
 	}
 
-	apiKey, ok := req.ProviderData.(string)
+	client, ok := req.ProviderData.(*LambdaClient)
 
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Resource Configure Type",
-			fmt.Sprintf("Expected *http.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected *LambdaClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
 	}
 
-	r.apiKey = apiKey
+	r.client = client
 }
 
 func (r *InstanceResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
@@ -201,47 +380,193 @@ func (r *InstanceResource) Create(ctx context.Context, req resource.CreateReques
 	if !data.FileSystemNames.IsNull() {
 		_ = data.FileSystemNames.ElementsAs(ctx, &fileSystemNames, false)
 	}
+	if data.Name.IsUnknown() {
+		n, err := uniqueName(data.NamePrefix.ValueString())
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Unable to generate instance name", err)
+			return
+		}
+		data.Name = types.StringValue(n)
+	}
 	if !data.Name.IsNull() {
-		*name = data.Name.ValueString()
+		n := data.Name.ValueString()
+		name = &n
+	}
+	userData := data.UserData.ValueString()
+	if !data.UserDataBase64.IsNull() {
+		var err error
+		userData, err = decodeUserData(data.UserDataBase64.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("user_data_base64"), "Invalid user_data_base64", err.Error())
+			return
+		}
 	}
-	httpResp, err := MakeAPICall(ctx, r.apiKey, http.MethodPost, "instance-operations/launch", InstanceCreateAPIRequest{
+	image, diags := instanceImage(ctx, data.Image)
+	resp.Diagnostics.Append(diags...)
+	tags, diags := tagsFromValue(ctx, data.TagsAll)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	// Values unknown while validating are only checked now.
+	var capacityTimeout time.Duration
+	if !data.WaitForCapacityTimeout.IsNull() {
+		var err error
+		if capacityTimeout, err = time.ParseDuration(data.WaitForCapacityTimeout.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("wait_for_capacity_timeout"), "Invalid wait_for_capacity_timeout", err.Error())
+			return
+		}
+	}
+	sshTimeout := sshConnectTimeout
+	if !data.SSHWaitTimeout.IsNull() {
+		var err error
+		if sshTimeout, err = time.ParseDuration(data.SSHWaitTimeout.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("ssh_wait_timeout"), "Invalid ssh_wait_timeout", err.Error())
+			return
+		}
+	}
+	id, attempts, err := r.client.LaunchInstanceWhenAvailable(ctx, InstanceCreateAPIRequest{
 		RegionName:       data.RegionName.ValueString(),
 		InstanceTypeName: data.InstanceTypeName.ValueString(),
 		SSHKeyNames:      sshKeys,
-		Quantity:         1,
 		FileSystemNames:  fileSystemNames,
 		Name:             name,
-	})
+		UserData:         userData,
+		Image:            image,
+		Tags:             tagList(tags),
+	}, capacityTimeout)
+	// The reservation made while planning is over whether or not the launch
+	// succeeded.
+	if r.client.guardrail != nil && !data.PriceCentsPerHour.IsUnknown() {
+		r.client.guardrail.release(int(data.PriceCentsPerHour.ValueInt64()))
+	}
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create example, got error: %s", err))
+		action := "Unable to launch instance"
+		if capacityTimeout > 0 && isInsufficientCapacity(err) {
+			action = fmt.Sprintf("Unable to launch instance, no capacity became available within %s after %d attempts", capacityTimeout, attempts)
+		}
+		addErrorDiagnostic(&resp.Diagnostics, action, err)
 		return
 	}
-	defer httpResp.Body.Close()
-	if httpResp.StatusCode != http.StatusOK {
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(httpResp.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
-			return
-		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
+	// Record the instance before waiting for it, an interrupted or failed wait
+	// then leaves a tainted resource to destroy instead of an unmanaged one.
+	data.IP = types.StringNull()
+	data.SSHHostKey = types.StringNull()
+	data.Status = types.StringValue(instanceStatusBooting)
+	data.Id = types.StringValue(id)
+	data.LaunchAttempts = types.Int64Value(int64(attempts))
+	if data.PriceCentsPerHour.IsUnknown() {
+		data.PriceCentsPerHour = types.Int64Null()
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
 		return
 	}
+	tflog.Trace(ctx, "created a resource")
+
+	waitCtx, cancel := context.WithTimeout(ctx, instanceBootTimeout)
+	defer cancel()
+	instance, err := r.client.WaitForInstanceActive(waitCtx, id)
+	if instance != nil {
+		if data.PriceCentsPerHour.IsNull() {
+			data.PriceCentsPerHour = types.Int64Value(int64(instance.InstanceType.PriceCentsHourly))
+		}
+		data.Status = types.StringValue(instance.Status)
+		if instance.IP != "" {
+			data.IP = types.StringValue(instance.IP)
+		}
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	}
+	switch {
+	case err == nil:
+		if data.WaitForSSH.ValueBool() {
+			r.waitForSSH(ctx, data, sshTimeout, &resp.Diagnostics)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+			if resp.Diagnostics.HasError() {
+				return
+			}
+		}
+		if !data.Provisioning.IsNull() {
+			r.provision(ctx, data, &resp.Diagnostics)
+		}
+	case ctx.Err() != nil:
+		resp.Diagnostics.AddWarning(
+			"Instance is still booting",
+			fmt.Sprintf("Stopped waiting for instance %s to become active because the operation was interrupted. "+
+				"The instance was launched and is recorded in state, it keeps booting and the next refresh picks up its address and status.", id),
+		)
+	case errors.Is(err, context.DeadlineExceeded):
+		addErrorDiagnostic(&resp.Diagnostics, "Instance did not become active", fmt.Errorf("instance %s still %s after %s", id, data.Status.ValueString(), instanceBootTimeout))
+	default:
+		addErrorDiagnostic(&resp.Diagnostics, "Instance did not become active", err)
+	}
+}
 
-	var respData InstanceCreateAPIResponse
-	if err := json.NewDecoder(httpResp.Body).Decode(&respData); err != nil {
-		resp.Diagnostics.AddError("json error", err.Error())
+func instanceImage(ctx context.Context, obj types.Object) (*Image, diag.Diagnostics) {
+	if obj.IsNull() || obj.IsUnknown() {
+		return nil, nil
+	}
+	var model InstanceImageModel
+	diags := obj.As(ctx, &model, basetypes.ObjectAsOptions{})
+	return &Image{Id: model.Id.ValueString(), Family: model.Family.ValueString()}, diags
+}
+
+func (r *InstanceResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data InstanceResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	if len(respData.Data.InstanceIds) != 1 {
-		resp.Diagnostics.AddError("resp error", fmt.Sprintf("expected 1 response got %d", len(respData.Data.InstanceIds)))
+	if !data.Name.IsNull() && !data.NamePrefix.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("name_prefix"), "Conflicting name", "Only one of name and name_prefix may be set.")
+	}
+	if !data.SSHWaitTimeout.IsNull() && !data.SSHWaitTimeout.IsUnknown() {
+		if _, err := time.ParseDuration(data.SSHWaitTimeout.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("ssh_wait_timeout"), "Invalid ssh_wait_timeout", err.Error())
+		}
+	}
+	// The settings of wait_for_ssh would be silently ignored without it.
+	if !data.WaitForSSH.IsUnknown() && !data.WaitForSSH.ValueBool() {
+		if !data.SSHWaitTimeout.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("ssh_wait_timeout"), "Missing wait_for_ssh", "ssh_wait_timeout only applies when wait_for_ssh is true.")
+		}
+		if !data.CaptureSSHHostKey.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("capture_ssh_host_key"), "Missing wait_for_ssh", "capture_ssh_host_key only applies when wait_for_ssh is true.")
+		}
+	}
+	if !data.WaitForCapacityTimeout.IsNull() && !data.WaitForCapacityTimeout.IsUnknown() {
+		if _, err := time.ParseDuration(data.WaitForCapacityTimeout.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("wait_for_capacity_timeout"), "Invalid wait_for_capacity_timeout", err.Error())
+		}
+	}
+	if !data.UserData.IsNull() && !data.UserDataBase64.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("user_data_base64"), "Conflicting user data", "Only one of user_data and user_data_base64 may be set.")
+	}
+	if !data.UserData.IsNull() && !data.UserData.IsUnknown() {
+		if err := checkUserDataSize(len(data.UserData.ValueString())); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("user_data"), "Invalid user_data", err.Error())
+		}
+	}
+	if !data.UserDataBase64.IsNull() && !data.UserDataBase64.IsUnknown() {
+		if _, err := decodeUserData(data.UserDataBase64.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("user_data_base64"), "Invalid user_data_base64", err.Error())
+		}
+	}
+
+	validateProvisioning(ctx, data.Provisioning, &resp.Diagnostics)
+
+	if data.Image.IsNull() || data.Image.IsUnknown() {
 		return
 	}
-	data.IP = types.StringNull()
-	data.Status = types.StringNull()
-	data.Id = types.StringValue(respData.Data.InstanceIds[0])
-	tflog.Trace(ctx, "created a resource")
-	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	var image InstanceImageModel
+	resp.Diagnostics.Append(data.Image.As(ctx, &image, basetypes.ObjectAsOptions{})...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if image.Id.IsNull() == image.Family.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("image"), "Invalid image", "Exactly one of image.id and image.family must be set.")
+	}
 }
 
 func (r *InstanceResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
@@ -252,45 +577,349 @@ func (r *InstanceResource) Read(ctx context.Context, req resource.ReadRequest, r
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	res, err := MakeAPICall(ctx, r.apiKey, http.MethodGet, fmt.Sprintf("instances/%s", data.Id.ValueString()), nil)
+	// Every instance in state is refreshed from one shared listing instead of
+	// fetching them one at a time.
+	instances, err := r.client.ListInstances(ctx)
 	if err != nil {
-		resp.Diagnostics.AddError("resp error", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to read instance", err)
 		return
 	}
-	if res.StatusCode == http.StatusNotFound {
+	instance := findInstance(instances, data.Id.ValueString())
+	if instance == nil {
 		resp.State.RemoveResource(ctx)
 		return
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(res.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
+	data.SshKeyNames, _ = types.ListValueFrom(ctx, types.StringType, instance.SshKeyNames)
+	data.InstanceTypeName = types.StringValue(instance.InstanceType.Name)
+	data.RegionName = types.StringValue(instance.Region.Name)
+	data.PriceCentsPerHour = types.Int64Value(int64(instance.InstanceType.PriceCentsHourly))
+	resp.Diagnostics.Append(reconcileTags(ctx, data, r.client.defaultTags, tagMap(instance.Tags))...)
+	if instance.Name != "" && !isLaunchToken(instance.Name) {
+		data.Name = types.StringValue(instance.Name)
+	}
+	data.Status = types.StringValue(instance.Status)
+	if instance.IP != "" {
+		data.IP = types.StringValue(instance.IP)
+	}
+	if instance.Status != instanceStatusActive {
+		resp.Diagnostics.AddWarning(
+			fmt.Sprintf("Instance is %s", instance.Status),
+			instanceStatusDetail(instance.Id, instance.Status, data.ReplaceOnUnhealthy.ValueBool()),
+		)
+	}
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func instanceStatusDetail(id, status string, replace bool) string {
+	switch {
+	case !isInstanceDefunct(status):
+		return fmt.Sprintf("Instance %s is %s, it cannot be reached until it becomes active.", id, status)
+	case replace:
+		return fmt.Sprintf("Instance %s is %s and will be replaced on the next apply because replace_on_unhealthy is set.", id, status)
+	default:
+		return fmt.Sprintf("Instance %s is %s. Set replace_on_unhealthy to replace it automatically, or replace it with terraform apply -replace.", id, status)
+	}
+}
+
+// isInstanceDefunct reports whether an instance in status will never become
+// active again on its own.
+func isInstanceDefunct(status string) bool {
+	return status == instanceStatusUnhealthy || status == instanceStatusTerminated
+}
+
+func (r *InstanceResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	var state, plan *InstanceResourceModel
+	if !req.State.Raw.IsNull() {
+		resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	}
+	if !req.Plan.Raw.IsNull() {
+		resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan == nil {
+		if state.TerminationProtection.ValueBool() {
+			addTerminationProtectionError(&resp.Diagnostics, state.Id.ValueString(), "destroyed")
+		}
+		return
+	}
+
+	var config *InstanceResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	resp.Diagnostics.Append(r.planTags(ctx, plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	switch {
+	case state == nil:
+		r.planDefaults(ctx, config, plan, &resp.Diagnostics)
+		planSSHHostKey(plan)
+		if resp.Diagnostics.HasError() {
 			return
 		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
-		if res.StatusCode == http.StatusNotFound {
-			resp.State.RemoveResource(ctx)
+		r.checkPolicy(plan, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
 		}
+		r.estimateCost(ctx, plan, nil, &resp.Diagnostics)
+		r.checkSpend(ctx, plan, "", &resp.Diagnostics)
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
 		return
 	}
 
-	var respData InstanceGetAPIResponse
-	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
-		resp.Diagnostics.AddError("json error", err.Error())
+	// Generated and unset names stay as launched, as do the values only
+	// recorded at launch, which are unset for imported instances.
+	if plan.Name.IsUnknown() && config.Name.IsNull() {
+		plan.Name = state.Name
+	}
+	if plan.LaunchAttempts.IsUnknown() {
+		plan.LaunchAttempts = state.LaunchAttempts
+	}
+	if plan.SSHHostKey.IsUnknown() {
+		plan.SSHHostKey = state.SSHHostKey
+	}
+	defunct := plan.ReplaceOnUnhealthy.ValueBool() && isInstanceDefunct(state.Status.ValueString())
+	retag := tagsChanged(ctx, state, plan)
+	if !defunct && !retag && !launchSettingsChanged(state, plan) {
+		// The instance keeps the tags it has, see reconcileTags.
+		plan.TagsAll = state.TagsAll
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
 		return
 	}
-	data.SshKeyNames, _ = types.ListValueFrom(ctx, types.StringType, respData.Data.SshKeyNames)
-	data.InstanceTypeName = types.StringValue(respData.Data.InstanceType.Name)
-	data.RegionName = types.StringValue(respData.Data.Region.Name)
-	// data.IP = types.StringValue(respData.Data.IP)
-	// data.Status = types.StringValue(respData.Data.Status)
-	// Save updated data into Terraform state
-	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	// The flag as last applied counts, turning it off in the same plan as
+	// the replacement does not lift the protection.
+	if state.TerminationProtection.ValueBool() {
+		addTerminationProtectionError(&resp.Diagnostics, state.Id.ValueString(), "replaced")
+		return
+	}
+
+	r.checkPolicy(plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The replacement is a new instance, nothing carries over from the
+	// one it replaces.
+	plan.Id = types.StringUnknown()
+	plan.IP = types.StringUnknown()
+	plan.Status = types.StringUnknown()
+	plan.LaunchAttempts = types.Int64Unknown()
+	plan.SSHHostKey = types.StringUnknown()
+	planSSHHostKey(plan)
+	if !config.NamePrefix.IsNull() {
+		plan.Name = types.StringUnknown()
+	}
+	r.estimateCost(ctx, plan, state, &resp.Diagnostics)
+	r.checkSpend(ctx, plan, state.Id.ValueString(), &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+	if defunct {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("status"))
+	}
+	if retag {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("tags"))
+	}
+}
+
+// planSSHHostKey leaves the host key of a new instance unset when it will not
+// be captured.
+func planSSHHostKey(plan *InstanceResourceModel) {
+	if (!plan.WaitForSSH.IsUnknown() && !plan.WaitForSSH.ValueBool()) ||
+		(!plan.CaptureSSHHostKey.IsUnknown() && !plan.CaptureSSHHostKey.IsNull() && !plan.CaptureSSHHostKey.ValueBool()) {
+		plan.SSHHostKey = types.StringNull()
+	}
+}
+
+// planDefaults resolves the region and SSH keys left out of the configuration
+// to the provider defaults, so the plan shows what will be launched. The name
+// is only left to be generated at create time when name_prefix is set.
+func (r *InstanceResource) planDefaults(ctx context.Context, config, plan *InstanceResourceModel, diags *diag.Diagnostics) {
+	if config.Name.IsNull() && config.NamePrefix.IsNull() {
+		plan.Name = types.StringNull()
+	}
+
+	var defaultRegion string
+	var defaultSSHKeyNames []string
+	if r.client != nil {
+		defaultRegion, defaultSSHKeyNames = r.client.defaultRegion, r.client.defaultSSHKeyNames
+	}
+
+	if config.RegionName.IsNull() {
+		if defaultRegion == "" {
+			diags.AddAttributeError(path.Root("region_name"), "Missing region_name",
+				"Set region_name on the instance or default_region on the provider.")
+		} else {
+			plan.RegionName = types.StringValue(defaultRegion)
+		}
+	}
+	if config.SshKeyNames.IsNull() {
+		if len(defaultSSHKeyNames) == 0 {
+			diags.AddAttributeError(path.Root("ssh_key_names"), "Missing ssh_key_names",
+				"Set ssh_key_names on the instance or default_ssh_key_names on the provider.")
+		} else {
+			var d diag.Diagnostics
+			plan.SshKeyNames, d = types.ListValueFrom(ctx, types.StringType, defaultSSHKeyNames)
+			diags.Append(d...)
+		}
+	}
+}
+
+// planTags computes tags_all from the resource tags and the provider default
+// tags.
+func (r *InstanceResource) planTags(ctx context.Context, plan *InstanceResourceModel) diag.Diagnostics {
+	if plan.Tags.IsUnknown() {
+		plan.TagsAll = types.MapUnknown(types.StringType)
+		return nil
+	}
+	tags, diags := tagsFromValue(ctx, plan.Tags)
+	if diags.HasError() {
+		return diags
+	}
+	var defaults map[string]string
+	if r.client != nil {
+		defaults = r.client.defaultTags
+	}
+	plan.TagsAll, diags = tagsValue(ctx, mergeTags(defaults, tags))
+	return diags
+}
+
+// tagsChanged reports whether the configured tags differ from the ones last
+// applied, which replaces the instance. Tags edited outside of Terraform and
+// provider default_tags do not count. Without tags applied before, such as
+// after an import, only configured tags the instance lacks count. Tags that
+// are not known yet may differ.
+func tagsChanged(ctx context.Context, state, plan *InstanceResourceModel) bool {
+	if plan.Tags.IsUnknown() {
+		return true
+	}
+	after, _ := tagsFromValue(ctx, plan.Tags)
+	if state.Tags.IsNull() {
+		current, _ := tagsFromValue(ctx, state.TagsAll)
+		return len(missingTags(after, current)) > 0
+	}
+	before, _ := tagsFromValue(ctx, state.Tags)
+	return len(before) != len(after) || len(missingTags(after, before)) > 0
+}
+
+// reconcileTags refreshes tags_all from the API and warns when the instance
+// lacks tags the configuration and provider default_tags give it. Tags can
+// only be set at launch, so such drift is reported rather than planned as a
+// replacement.
+func reconcileTags(ctx context.Context, data *InstanceResourceModel, defaults, current map[string]string) diag.Diagnostics {
+	var diags diag.Diagnostics
+	data.TagsAll, diags = tagsValue(ctx, current)
+	tags, d := tagsFromValue(ctx, data.Tags)
+	diags.Append(d...)
+	if diags.HasError() {
+		return diags
+	}
+	if missing := missingTags(mergeTags(defaults, tags), current); len(missing) > 0 {
+		diags.AddAttributeWarning(path.Root("tags"), "Instance tags differ from configuration",
+			fmt.Sprintf("Instance %s lacks the configured value of the tags %s. Tags can only be set at launch, tags edited outside of Terraform "+
+				"or changed in the provider default_tags apply once the instance is replaced, e.g. with terraform apply -replace.",
+				data.Id.ValueString(), strings.Join(missing, ", ")))
+	}
+	return diags
+}
+
+// launchSettingsChanged reports whether the plan changes a setting only
+// applied at launch, which the schema marks as requiring replacement.
+func launchSettingsChanged(state, plan *InstanceResourceModel) bool {
+	return !state.NamePrefix.Equal(plan.NamePrefix) ||
+		!state.UserData.Equal(plan.UserData) ||
+		!state.UserDataBase64.Equal(plan.UserDataBase64) ||
+		!state.Image.Equal(plan.Image)
+}
+
+// estimateCost fills in the planned price of a new instance from the instance
+// type catalog and warns about the change in spend, relative to the replaced
+// instance when there is one. A catalog that cannot be read only costs the
+// estimate, never the plan.
+func (r *InstanceResource) estimateCost(ctx context.Context, plan, replaced *InstanceResourceModel, diags *diag.Diagnostics) {
+	plan.PriceCentsPerHour = types.Int64Unknown()
+	if plan.InstanceTypeName.IsUnknown() || r.client == nil {
+		return
+	}
+	price, err := r.client.InstanceTypePrice(ctx, plan.InstanceTypeName.ValueString())
+	if err != nil {
+		tflog.Warn(ctx, "unable to estimate instance cost", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	plan.PriceCentsPerHour = types.Int64Value(int64(price))
+
+	delta := price
+	detail := fmt.Sprintf("Launching a %s instance costs %s/hour, about %s/month.",
+		plan.InstanceTypeName.ValueString(), formatCents(price), formatCents(price*hoursPerMonth))
+	if replaced != nil {
+		delta -= int(replaced.PriceCentsPerHour.ValueInt64())
+		detail = fmt.Sprintf("Replacing instance %s with a %s instance changes spend by %s/hour, about %s/month.",
+			replaced.Id.ValueString(), plan.InstanceTypeName.ValueString(), formatCents(delta), formatCents(delta*hoursPerMonth))
+	}
+	diags.AddAttributeWarning(path.Root("instance_type_name"), "Instance cost estimate", detail)
+}
+
+// checkPolicy reports the planned region and instance type the provider
+// launch policy rejects. Values not known yet are checked when the plan is
+// applied.
+func (r *InstanceResource) checkPolicy(plan *InstanceResourceModel, diags *diag.Diagnostics) {
+	if r.client == nil || r.client.policy == nil {
+		return
+	}
+	if !plan.RegionName.IsUnknown() {
+		if reason := r.client.policy.checkRegion(plan.RegionName.ValueString()); reason != "" {
+			diags.AddAttributeError(path.Root("region_name"), "Region not allowed", reason)
+		}
+	}
+	if !plan.InstanceTypeName.IsUnknown() {
+		if reason := r.client.policy.checkInstanceType(plan.InstanceTypeName.ValueString()); reason != "" {
+			diags.AddAttributeError(path.Root("instance_type_name"), "Instance type not allowed", reason)
+		}
+	}
+}
+
+// checkSpend enforces the provider spend guardrail for a planned instance,
+// replacing the instance replacedID when not empty. Instances whose type is
+// not known yet are checked again when the plan is applied.
+func (r *InstanceResource) checkSpend(ctx context.Context, plan *InstanceResourceModel, replacedID string, diags *diag.Diagnostics) {
+	if r.client == nil || r.client.guardrail == nil || plan.InstanceTypeName.IsUnknown() {
+		return
+	}
+	if plan.PriceCentsPerHour.IsUnknown() {
+		diags.AddAttributeError(
+			path.Root("instance_type_name"),
+			"Unable to check spend limits",
+			fmt.Sprintf("The price of instance type %q could not be looked up, so the max_hourly_spend_cents and max_instances provider limits cannot be enforced.", plan.InstanceTypeName.ValueString()),
+		)
+		return
+	}
+	err := r.client.guardrail.reserve(ctx, r.client, int(plan.PriceCentsPerHour.ValueInt64()), replacedID)
+	if err != nil {
+		diags.AddAttributeError(path.Root("instance_type_name"), "Spend limit exceeded", fmt.Sprintf("Refusing to plan this instance, %s.", err))
+	}
+}
+
+func addTerminationProtectionError(diags *diag.Diagnostics, id, action string) {
+	diags.AddError(
+		"Instance is protected from termination",
+		fmt.Sprintf("Instance %s cannot be %s while termination_protection is enabled. "+
+			"Set termination_protection to false and apply that change on its own first.", id, action),
+	)
+}
+
+func findInstance(instances []Instance, id string) *Instance {
+	for i := range instances {
+		if instances[i].Id == id {
+			return &instances[i]
+		}
+	}
+	return nil
 }
 
 func (r *InstanceResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data *InstanceResource
+	var data *InstanceResourceModel
 
 	// Read Terraform plan data into the model
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
@@ -299,15 +928,8 @@ func (r *InstanceResource) Update(ctx context.Context, req resource.UpdateReques
 		return
 	}
 
-	// If applicable, this is a great opportunity to initialize any necessary
-	// provider client data and make a call using it.
-	// httpResp, err := r.client.Do(httpReq)
-	// if err != nil {
-	//     resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update example, got error: %s", err))
-	//     return
-	// }
-
-	// Save updated data into Terraform state
+	// Only provider side settings such as termination_protection change in
+	// place, there is nothing to send to the API.
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -320,31 +942,65 @@ func (r *InstanceResource) Delete(ctx context.Context, req resource.DeleteReques
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	res, err := MakeAPICall(ctx, r.apiKey, http.MethodPost, "instance-operations/terminate", InstanceDeleteApiRequest{
+	if data.TerminationProtection.ValueBool() {
+		addTerminationProtectionError(&resp.Diagnostics, data.Id.ValueString(), "terminated")
+		return
+	}
+	res, err := r.client.MakeAPICall(ctx, http.MethodPost, "instance-operations/terminate", InstanceDeleteApiRequest{
 		InstanceIds: []string{data.Id.ValueString()},
 	})
 	if err != nil {
-		resp.Diagnostics.AddError("resp error", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to terminate instance", err)
 		return
 	}
 	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(res.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
-			return
-		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Already gone, whatever the body says.
+		return
+	default:
+		addAPIErrorDiagnostic(&resp.Diagnostics, "Unable to terminate instance", res)
 		return
 	}
 
 	var respData InstanceDeleteApiResponse
 	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
-		resp.Diagnostics.AddError("json error", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to read terminate response", err)
 		return
 	}
 }
 
 func (r *InstanceResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+	kind, value := parseImportID(req.ID)
+	if kind == "" {
+		resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+		return
+	}
+	if kind != "name" && kind != "ip" {
+		resp.Diagnostics.AddError(
+			"Invalid import ID",
+			fmt.Sprintf("Unsupported import ID prefix %q, expected an instance id, name:<name> or ip:<address>.", kind),
+		)
+		return
+	}
+
+	instances, err := r.client.ListInstances(ctx)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to list instances", err)
+		return
+	}
+
+	var ids []string
+	for _, instance := range instances {
+		if (kind == "name" && instance.Name == value) || (kind == "ip" && instance.IP == value) {
+			ids = append(ids, instance.Id)
+		}
+	}
+	id, err := resolveImportID("instance", kind, value, ids)
+	if err != nil {
+		resp.Diagnostics.AddError("Cannot import instance", err.Error())
+		return
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), id)...)
 }
@@ -1,29 +1,45 @@
 package provider
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestAccInstanceResource(t *testing.T) {
+	rec := testAccCassette(t)
+	name := rec.Var("name", func() string { return fmt.Sprintf("%sinstance-%d", testAccResourcePrefix, rand.Int()) })
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		ProtoV6ProviderFactories: testAccProviderFactoriesWithCassette(rec),
 		Steps: []resource.TestStep{
 			{
-				Config: testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop"),
+				Config: testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop", name),
 				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "name", name),
 					resource.TestCheckResourceAttr("lambdalabs_instance.test", "instance_type_name", "gpu_1x_a10"),
 					resource.TestCheckResourceAttr("lambdalabs_instance.test", "region_name", "us-west-1"),
 					resource.TestCheckResourceAttrSet("lambdalabs_instance.test", "id"),
 				),
 			},
 			{
-				ResourceName:      "lambdalabs_instance.test",
-				ImportState:       true,
-				ImportStateVerify: true,
+				ResourceName:            "lambdalabs_instance.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"launch_attempts"},
 				Check: resource.ComposeAggregateTestCheckFunc(
 					resource.TestCheckResourceAttrSet("lambdalabs_instance.test", "ip"),
 					resource.TestCheckResourceAttrSet("lambdalabs_instance.test", "status"),
@@ -33,12 +49,946 @@ func TestAccInstanceResource(t *testing.T) {
 	})
 }
 
-func testAccExampleResourceConfig(instance, region, ssh_key string) string {
+func TestInstanceResource_mock(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := testMockProviderConfig(srv) + testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop", "mock-instance")
+	// A second instance with the same name makes importing by name ambiguous.
+	withTwin := config + `
+resource "lambdalabs_instance" "twin" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  name               = "mock-instance"
+}
+`
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.Instances()); n != 0 {
+				return fmt.Errorf("%d instances still running", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "instance_type_name", "gpu_1x_a10"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "region_name", "us-west-1"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "status", "active"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "price_cents_per_hour", "75"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "launch_attempts", "1"),
+					resource.TestCheckResourceAttrSet("lambdalabs_instance.test", "ip"),
+					resource.TestCheckResourceAttrSet("lambdalabs_instance.test", "id"),
+				),
+			},
+			{
+				Config:                  config,
+				ResourceName:            "lambdalabs_instance.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"launch_attempts"},
+			},
+			{
+				Config:                  config,
+				ResourceName:            "lambdalabs_instance.test",
+				ImportState:             true,
+				ImportStateId:           "name:mock-instance",
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"launch_attempts"},
+			},
+			{
+				Config:       config,
+				ResourceName: "lambdalabs_instance.test",
+				ImportState:  true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					return "ip:" + s.RootModule().Resources["lambdalabs_instance.test"].Primary.Attributes["ip"], nil
+				},
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"launch_attempts"},
+			},
+			{
+				Config: withTwin,
+			},
+			{
+				Config:        withTwin,
+				ResourceName:  "lambdalabs_instance.test",
+				ImportState:   true,
+				ImportStateId: "name:mock-instance",
+				ExpectError:   regexp.MustCompile(`2 instances found with name "mock-instance"`),
+			},
+		},
+	})
+	if n := srv.RequestCount(http.MethodPost, "instance-operations/launch"); n != 2 {
+		t.Errorf("expected two launches, got %d", n)
+	}
+}
+
+func TestInstanceResource_mockCapacityError(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testMockProviderConfig(srv) + testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop", "mock-instance"),
+				ExpectError: regexp.MustCompile("Insufficient capacity"),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockCapacityWaitTimeout(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name               = "us-west-1"
+  instance_type_name        = "gpu_1x_a10"
+  ssh_key_names             = ["laptop"]
+  wait_for_capacity_timeout = "forever"
+}
+`,
+				ExpectError: regexp.MustCompile("Invalid wait_for_capacity_timeout"),
+			},
+			{
+				// Only known once the SSH key is created.
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_sshkey" "unknown" {
+  name       = "ci"
+  public_key = "ssh-ed25519 BBBB"
+}
+
+resource "lambdalabs_instance" "test" {
+  region_name               = "us-west-1"
+  instance_type_name        = "gpu_1x_a10"
+  ssh_key_names             = ["laptop"]
+  wait_for_capacity_timeout = lambdalabs_sshkey.unknown.id
+}
+`,
+				ExpectError: regexp.MustCompile("Invalid wait_for_capacity_timeout"),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name               = "us-west-1"
+  instance_type_name        = "gpu_1x_a10"
+  ssh_key_names             = ["laptop"]
+  wait_for_capacity_timeout = "1s"
+}
+`,
+				ExpectError: regexp.MustCompile("no capacity became available"),
+			},
+		},
+	})
+	if n := len(srv.Instances()); n != 0 {
+		t.Errorf("expected no instances, got %d", n)
+	}
+}
+
+func TestInstanceResource_mockDeleteNotFound(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop", "mock-instance"),
+			},
+			{
+				// A gateway answering the terminate call with a non JSON
+				// 404 still means the instance is gone.
+				PreConfig: func() {
+					srv.AddFault(lambdamock.Fault{
+						Method:      http.MethodPost,
+						Path:        "instance-operations/terminate",
+						Status:      http.StatusNotFound,
+						RawBody:     "<html>Not Found</html>",
+						AfterCommit: true,
+					})
+				},
+				Config: testMockProviderConfig(srv),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockFailedWaitTaints(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	// The launch goes through but the first status poll fails.
+	srv.AddFault(lambdamock.Fault{Method: http.MethodGet, Path: "instances/*", Status: http.StatusInternalServerError})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.Instances()); n != 0 {
+				return fmt.Errorf("%d instances left running", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+}
+`,
+				ExpectError: regexp.MustCompile("Instance did not become active"),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockReplaceOnUnhealthy(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name          = "us-west-1"
+  instance_type_name   = "gpu_1x_a10"
+  ssh_key_names        = ["laptop"]
+  replace_on_unhealthy = true
+}
+`
+	var firstID string
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: func(s *terraform.State) error {
+					firstID = s.RootModule().Resources["lambdalabs_instance.test"].Primary.ID
+					return nil
+				},
+			},
+			{
+				PreConfig: func() { srv.SetInstanceStatus(firstID, lambdamock.StatusUnhealthy) },
+				Config:    config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "status", "active"),
+					func(s *terraform.State) error {
+						if id := s.RootModule().Resources["lambdalabs_instance.test"].Primary.ID; id == firstID {
+							return fmt.Errorf("unhealthy instance %s was not replaced", id)
+						}
+						if instance, ok := srv.Instance(firstID); ok && instance.Status != lambdamock.StatusTerminated {
+							return fmt.Errorf("unhealthy instance is %s", instance.Status)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockKeepsUnhealthy(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := testMockProviderConfig(srv) + testAccExampleResourceConfig("gpu_1x_a10", "us-west-1", "laptop", "mock-instance")
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				PreConfig: func() {
+					for _, instance := range srv.Instances() {
+						srv.SetInstanceStatus(instance.ID, lambdamock.StatusUnhealthy)
+					}
+				},
+				Config:   config,
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockTerminationProtection(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := func(protected bool) string {
+		return testMockProviderConfig(srv) + fmt.Sprintf(`
+resource "lambdalabs_instance" "test" {
+  region_name            = "us-west-1"
+  instance_type_name     = "gpu_1x_a10"
+  ssh_key_names          = ["laptop"]
+  replace_on_unhealthy   = true
+  termination_protection = %t
+}
+`, protected)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.Instances()); n != 0 {
+				return fmt.Errorf("%d instances still running", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: config(true),
+			},
+			{
+				Config:      testMockProviderConfig(srv),
+				ExpectError: regexp.MustCompile("Instance is protected from termination"),
+			},
+			{
+				PreConfig: func() {
+					for _, instance := range srv.Instances() {
+						srv.SetInstanceStatus(instance.ID, lambdamock.StatusUnhealthy)
+					}
+				},
+				Config:      config(false),
+				ExpectError: regexp.MustCompile("cannot be replaced"),
+			},
+			{
+				PreConfig: func() {
+					for _, instance := range srv.Instances() {
+						srv.SetInstanceStatus(instance.ID, "")
+					}
+				},
+				Config: config(false),
+				Check:  resource.TestCheckResourceAttr("lambdalabs_instance.test", "termination_protection", "false"),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockSpendGuardrail(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := func(limits string, count int) string {
+		return fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key  = "mock"
+  endpoint = %[1]q
+  %[2]s
+}
+
+resource "lambdalabs_instance" "test" {
+  count              = %[3]d
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+}
+`, srv.Endpoint(), limits, count)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config("max_instances = 2", 3),
+				ExpectError: regexp.MustCompile("Spend limit exceeded"),
+			},
+			{
+				Config: config("max_hourly_spend_cents = 200", 2),
+				Check: func(*terraform.State) error {
+					if n := len(srv.Instances()); n != 2 {
+						return fmt.Errorf("expected 2 instances, got %d", n)
+					}
+					return nil
+				},
+			},
+			{
+				Config:      config("max_hourly_spend_cents = 200", 3),
+				ExpectError: regexp.MustCompile("Spend limit exceeded"),
+			},
+		},
+	})
+	if n := srv.RequestCount(http.MethodPost, "instance-operations/launch"); n != 2 {
+		t.Errorf("expected only the 2 allowed launches, got %d", n)
+	}
+}
+
+func TestInstanceResource_mockLaunchPolicy(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := func(policy, instanceType string) string {
+		return fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key  = "mock"
+  endpoint = %[1]q
+  %[2]s
+}
+
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = %[3]q
+  ssh_key_names      = ["laptop"]
+}
+`, srv.Endpoint(), policy, instanceType)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(`allowed_instance_types = ["gpu_1x_*"]`, "gpu_8x_h100_sxm5"),
+				ExpectError: regexp.MustCompile("Instance type not allowed"),
+			},
+			{
+				Config:      config(`allowed_regions = ["us-east-*"]`, "gpu_1x_a10"),
+				ExpectError: regexp.MustCompile("Region not allowed"),
+			},
+			{
+				Config:      config(`denied_instance_types = ["gpu_[8x"]`, "gpu_1x_a10"),
+				ExpectError: regexp.MustCompile("Invalid pattern"),
+			},
+		},
+	})
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("expected the policy to be enforced before any API call, got %d requests", n)
+	}
+}
+
+func TestInstanceResource_mockUserDataAndImage(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := func(extra string) string {
+		return testMockProviderConfig(srv) + fmt.Sprintf(`
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  %s
+}
+`, extra)
+	}
+	var firstID string
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config(`image = { id = "img-1", family = "lambda-stack" }`),
+				ExpectError: regexp.MustCompile("Exactly one of image.id and image.family"),
+			},
+			{
+				Config:      config(`user_data = "#cloud-config"` + "\n" + `user_data_base64 = "I2Nsb3VkLWNvbmZpZw=="`),
+				ExpectError: regexp.MustCompile("Conflicting user data"),
+			},
+			{
+				Config: config(fmt.Sprintf(`user_data_base64 = %q`+"\n"+`image = { family = "lambda-stack" }`, gzipBase64(t, "#cloud-config\n"))),
+				Check: func(s *terraform.State) error {
+					firstID = s.RootModule().Resources["lambdalabs_instance.test"].Primary.ID
+					var launch InstanceCreateAPIRequest
+					for _, req := range srv.Requests() {
+						if req.Path == "instance-operations/launch" {
+							if err := json.Unmarshal([]byte(req.Body), &launch); err != nil {
+								return err
+							}
+						}
+					}
+					if launch.UserData != "#cloud-config\n" {
+						return fmt.Errorf("launched with user data %q", launch.UserData)
+					}
+					if launch.Image == nil || launch.Image.Family != "lambda-stack" {
+						return fmt.Errorf("launched with image %+v", launch.Image)
+					}
+					return nil
+				},
+			},
+			{
+				Config: config(`user_data = "#cloud-config"` + "\n" + `image = { family = "lambda-stack" }`),
+				Check: func(s *terraform.State) error {
+					if id := s.RootModule().Resources["lambdalabs_instance.test"].Primary.ID; id == firstID {
+						return fmt.Errorf("changing user data did not replace instance %s", id)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockTags(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	configWith := func(defaultTags, tags string) string {
+		return fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key  = "mock"
+  endpoint = %q
+
+  default_tags {
+    tags = %s
+  }
+}
+
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  tags               = %s
+}
+`, srv.Endpoint(), defaultTags, tags)
+	}
+	config := configWith(`{ team = "ml", env = "dev" }`, `{ env = "prod", project = "llm" }`)
+	var id string
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags.%", "2"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags_all.%", "3"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags_all.env", "prod"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags_all.team", "ml"),
+					func(*terraform.State) error {
+						want := []lambdamock.Tag{{Key: "env", Value: "prod"}, {Key: "project", Value: "llm"}, {Key: "team", Value: "ml"}}
+						instances := srv.Instances()
+						if len(instances) != 1 || !reflect.DeepEqual(instances[0].Tags, want) {
+							return fmt.Errorf("launched with tags %+v, want %+v", instances, want)
+						}
+						id = instances[0].ID
+						return nil
+					},
+				),
+			},
+			{
+				// Drift is only warned about, tags cannot be set in place.
+				PreConfig: func() {
+					srv.SetInstanceTags(id, []lambdamock.Tag{{Key: "env", Value: "prod"}})
+				},
+				Config:   config,
+				PlanOnly: true,
+			},
+			{
+				// New default tags apply to new instances only.
+				Config: configWith(`{ team = "ml", env = "dev", owner = "ci" }`, `{ env = "prod", project = "llm" }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPtr("lambdalabs_instance.test", "id", &id),
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags_all.%", "1"),
+				),
+			},
+			{
+				Config: configWith(`{ team = "ml", env = "dev" }`, `{ env = "prod", project = "vision" }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					func(*terraform.State) error {
+						instances := srv.Instances()
+						if len(instances) != 1 || instances[0].ID == id {
+							return fmt.Errorf("expected the instance to be replaced, got %+v", instances)
+						}
+						return nil
+					},
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "tags_all.project", "vision"),
+				),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockProviderDefaults(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	srv.AddSSHKey("ci", "ssh-ed25519 BBBB")
+	provider := fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key               = "mock"
+  endpoint              = %q
+  default_region        = "us-east-1"
+  default_ssh_key_names = ["laptop"]
+}
+`, srv.Endpoint())
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: provider + `
+resource "lambdalabs_instance" "defaults" {
+  instance_type_name = "gpu_1x_a10"
+}
+
+resource "lambdalabs_instance" "explicit" {
+  instance_type_name = "gpu_1x_a10"
+  region_name        = "us-west-1"
+  ssh_key_names      = ["ci"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.defaults", "region_name", "us-east-1"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.defaults", "ssh_key_names.0", "laptop"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.explicit", "region_name", "us-west-1"),
+					resource.TestCheckResourceAttr("lambdalabs_instance.explicit", "ssh_key_names.0", "ci"),
+				),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockMissingRegion(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+}
+`,
+				ExpectError: regexp.MustCompile("Missing region_name"),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockBatchedLaunch(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key             = "mock"
+  endpoint            = %[1]q
+  launch_batch_window = "1s"
+}
+
+resource "lambdalabs_instance" "test" {
+  count              = 3
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+}
+`, srv.Endpoint()),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("lambdalabs_instance.test.0", "id"),
+					resource.TestCheckResourceAttrSet("lambdalabs_instance.test.1", "id"),
+					resource.TestCheckResourceAttrSet("lambdalabs_instance.test.2", "id"),
+				),
+			},
+		},
+	})
+	if n := srv.RequestCount(http.MethodPost, "instance-operations/launch"); n != 1 {
+		t.Errorf("expected the 3 instances to be launched together, got %d launches", n)
+	}
+}
+
+func TestInstanceResource_mockLostLaunchResponse(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	srv.AddFault(lambdamock.Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusGatewayTimeout, AfterCommit: true})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckNoResourceAttr("lambdalabs_instance.test", "name"),
+					func(s *terraform.State) error {
+						instances := srv.Instances()
+						if len(instances) != 1 {
+							return fmt.Errorf("expected 1 instance, got %d", len(instances))
+						}
+						return resource.TestCheckResourceAttr("lambdalabs_instance.test", "id", instances[0].ID)(s)
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockNamePrefix(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	config := testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  count              = 2
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  name_prefix        = "ci-"
+}
+`
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  name               = "trainer"
+  name_prefix        = "ci-"
+}
+`,
+				ExpectError: regexp.MustCompile("Conflicting name"),
+			},
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestMatchResourceAttr("lambdalabs_instance.test.0", "name", regexp.MustCompile("^ci-")),
+					resource.TestMatchResourceAttr("lambdalabs_instance.test.1", "name", regexp.MustCompile("^ci-")),
+					func(s *terraform.State) error {
+						names := map[string]bool{}
+						for _, instance := range srv.Instances() {
+							if instance.Name == nil {
+								return fmt.Errorf("instance %s launched without a name", instance.ID)
+							}
+							names[*instance.Name] = true
+						}
+						for _, key := range []string{"lambdalabs_instance.test.0", "lambdalabs_instance.test.1"} {
+							if name := s.RootModule().Resources[key].Primary.Attributes["name"]; !names[name] {
+								return fmt.Errorf("%s has name %q, launched %v", key, name, names)
+							}
+						}
+						if len(names) != 2 {
+							return fmt.Errorf("launched with names %v, want two distinct names", names)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: strings.Replace(config, `"ci-"`, `"nightly-"`, 1),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestMatchResourceAttr("lambdalabs_instance.test.0", "name", regexp.MustCompile("^nightly-")),
+					resource.TestMatchResourceAttr("lambdalabs_instance.test.1", "name", regexp.MustCompile("^nightly-")),
+				),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockProvisioning(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	sshSrv := newTestSSHServer(t, testShellHandler)
+	config := func(commands string) string {
+		return testMockProviderConfig(srv) + fmt.Sprintf(`
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+
+  provisioning {
+    private_key = %q
+    commands    = %s
+  }
+}
+`, sshSrv.privateKey, commands)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testMockProviderFactoriesWithSSH(sshSrv.dial),
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.Instances()); n != 0 {
+				return fmt.Errorf("%d instances still running", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config:      config("[]"),
+				ExpectError: regexp.MustCompile("Missing commands"),
+			},
+			{
+				Config: config(`["nvidia-smi", "pip install torch"]`),
+				Check: func(*terraform.State) error {
+					want := []string{"nvidia-smi", "pip install torch"}
+					if got := sshSrv.Commands(); !reflect.DeepEqual(got, want) {
+						return fmt.Errorf("ran %v, want %v", got, want)
+					}
+					return nil
+				},
+			},
+			{
+				// Provisioning only runs at launch.
+				Config: config(`["nvidia-smi", "pip install torch", "exit 3"]`),
+				Check: func(*terraform.State) error {
+					if n := len(sshSrv.Commands()); n != 2 {
+						return fmt.Errorf("expected no more commands to run, got %v", sshSrv.Commands())
+					}
+					return nil
+				},
+			},
+			{
+				Config:      config(`["nvidia-smi", "pip install torch", "exit 3"]`),
+				Taint:       []string{"lambdalabs_instance.test"},
+				ExpectError: regexp.MustCompile("Provisioning failed"),
+			},
+			{
+				Config:             config(`["nvidia-smi", "pip install torch", "exit 3"]`),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockWaitForSSH(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	sshSrv := newTestSSHServer(t, testShellHandler)
+	hostKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshSrv.hostKey)))
+	config := func(protected bool) string {
+		return testMockProviderConfig(srv) + fmt.Sprintf(`
+resource "lambdalabs_instance" "test" {
+  region_name            = "us-west-1"
+  instance_type_name     = "gpu_1x_a10"
+  ssh_key_names          = ["laptop"]
+  wait_for_ssh           = true
+  termination_protection = %t
+
+  provisioning {
+    private_key = %q
+    commands    = ["uptime"]
+  }
+}
+`, protected, sshSrv.privateKey)
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testMockProviderFactoriesWithSSH(sshSrv.dial),
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_instance.test", "ssh_host_key", hostKey),
+					func(*terraform.State) error {
+						if got := sshSrv.Commands(); len(got) != 1 {
+							return fmt.Errorf("expected the provisioning command to run, got %v", got)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: config(true),
+				Check:  resource.TestCheckResourceAttr("lambdalabs_instance.test", "ssh_host_key", hostKey),
+			},
+			{
+				Config: config(false),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockWaitForSSHPortOnly(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	// Connections are accepted but never answered, only probing the port
+	// gets past them.
+	silent := func(context.Context, string, string) (net.Conn, error) {
+		conn, peer := net.Pipe()
+		t.Cleanup(func() { peer.Close() })
+		return conn, nil
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testMockProviderFactoriesWithSSH(silent),
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  ssh_wait_timeout   = "1m"
+}
+`,
+				ExpectError: regexp.MustCompile("Missing wait_for_ssh"),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name          = "us-west-1"
+  instance_type_name   = "gpu_1x_a10"
+  ssh_key_names        = ["laptop"]
+  wait_for_ssh         = true
+  capture_ssh_host_key = false
+}
+`,
+				Check: resource.TestCheckNoResourceAttr("lambdalabs_instance.test", "ssh_host_key"),
+			},
+		},
+	})
+}
+
+func TestInstanceResource_mockWaitForSSHUnreachable(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	refuse := func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testMockProviderFactoriesWithSSH(refuse),
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  wait_for_ssh       = true
+  ssh_wait_timeout   = "1s"
+}
+`,
+				ExpectError: regexp.MustCompile("not reachable over SSH"),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_instance" "test" {
+  region_name        = "us-west-1"
+  instance_type_name = "gpu_1x_a10"
+  ssh_key_names      = ["laptop"]
+  wait_for_ssh       = true
+  ssh_wait_timeout   = "1s"
+}
+`,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func testAccExampleResourceConfig(instance, region, ssh_key, name string) string {
 	return fmt.Sprintf(`
 resource "lambdalabs_instance" "test" {
   region_name = %[1]q
   instance_type_name = %[2]q
   ssh_key_names = [%[3]q]
+  name = %[4]q
 }
-`, region, instance, ssh_key)
+`, region, instance, ssh_key, name)
 }
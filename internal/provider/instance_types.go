@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+)
+
+// hoursPerMonth is the average number of hours in a month, as used by the
+// Lambda pricing page.
+const hoursPerMonth = 730
+
+type Region struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type InstanceType struct {
+	Name             string      `json:"name"`
+	Description      string      `json:"description"`
+	PriceCentsHourly int         `json:"price_cents_per_hour"`
+	Specs            interface{} `json:"specs"`
+}
+
+type InstanceTypeAvailability struct {
+	InstanceType                 InstanceType `json:"instance_type"`
+	RegionsWithCapacityAvailable []Region     `json:"regions_with_capacity_available"`
+}
+
+type InstanceTypesAPIResponse struct {
+	Data map[string]InstanceTypeAvailability `json:"data"`
+}
+
+// ListInstanceTypes returns the instance type catalog keyed by type name,
+// along with the regions that currently have capacity for each.
+func (c *LambdaClient) ListInstanceTypes(ctx context.Context) (map[string]InstanceTypeAvailability, error) {
+	var respData InstanceTypesAPIResponse
+	if err := c.cachedGet(ctx, "instance-types", &respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
+
+// InstanceTypePrice returns the hourly price of an instance type in cents.
+func (c *LambdaClient) InstanceTypePrice(ctx context.Context, name string) (int, error) {
+	catalog, err := c.ListInstanceTypes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	instanceType, ok := catalog[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown instance type %q", name)
+	}
+	return instanceType.InstanceType.PriceCentsHourly, nil
+}
+
+// formatCents renders an amount of cents as dollars, e.g. -1250 as -$12.50.
+func formatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func TestFormatCents(t *testing.T) {
+	for cents, want := range map[int]string{
+		0:       "$0.00",
+		75:      "$0.75",
+		2392:    "$23.92",
+		1746160: "$17461.60",
+		-1250:   "-$12.50",
+	} {
+		if got := formatCents(cents); got != want {
+			t.Errorf("formatCents(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
+
+func TestInstanceTypePrice(t *testing.T) {
+	client, _ := testMockClient(t, lambdamock.Options{})
+
+	price, err := client.InstanceTypePrice(context.Background(), "gpu_8x_h100_sxm5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 2392 {
+		t.Errorf("expected 2392 cents, got %d", price)
+	}
+	if _, err := client.InstanceTypePrice(context.Background(), "gpu_0x_none"); err == nil {
+		t.Error("expected an unknown instance type to fail")
+	}
+}
@@ -0,0 +1,406 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// launchTimeout bounds a batched launch call, which runs detached from the
+// creates waiting on it.
+const launchTimeout = 5 * time.Minute
+
+// launchTokenPrefix starts the names generated for unnamed launches. The name
+// doubles as an idempotency token to find the instances of a launch whose
+// response was lost.
+const launchTokenPrefix = "tf-launch-"
+
+const (
+	orphanSearchAttempts = 6
+	orphanSearchInterval = 5 * time.Second
+	// orphanSearchTimeout bounds the whole search, which runs detached from
+	// the launch since a launch cut short by its context is ambiguous too.
+	orphanSearchTimeout = 2 * time.Minute
+)
+
+func newLaunchToken() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return launchTokenPrefix + hex.EncodeToString(raw), nil
+}
+
+// isLaunchToken reports whether an instance name was generated by the provider
+// rather than configured.
+func isLaunchToken(name string) bool {
+	return strings.HasPrefix(name, launchTokenPrefix)
+}
+
+// LaunchInstances launches req.Quantity instances and returns their ids.
+//
+// Every launch is identified by its name, generated when none is configured.
+// When the outcome of the launch call is ambiguous, because the connection
+// failed, timed out, was cancelled or the API answered with a server error,
+// the instances are searched by that name and adopted instead of being left
+// running unmanaged.
+func (c *LambdaClient) LaunchInstances(ctx context.Context, req InstanceCreateAPIRequest) ([]string, error) {
+	if req.Name == nil {
+		token, err := newLaunchToken()
+		if err != nil {
+			return nil, err
+		}
+		req.Name = &token
+	}
+	// Configured names may already be in use, those instances are not ours.
+	// The listing must not predate launches that just happened.
+	existing := map[string]bool{}
+	if !isLaunchToken(*req.Name) {
+		instances, err := c.fetchInstances(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			existing[instance.Id] = true
+		}
+	}
+
+	c.claims.begin(*req.Name)
+	ids, err := c.launchInstances(ctx, req)
+	c.claims.end(*req.Name, ids)
+	if err == nil || !isAmbiguousLaunchError(err) {
+		return ids, err
+	}
+	tflog.Warn(ctx, "launch outcome unknown, searching for launched instances", map[string]interface{}{
+		"name":  *req.Name,
+		"error": err.Error(),
+	})
+	searchCtx, cancel := context.WithTimeout(detachedContext{ctx}, orphanSearchTimeout)
+	defer cancel()
+	adopted := c.findLaunchedInstances(searchCtx, *req.Name, req.Quantity, existing)
+	if len(adopted) == 0 {
+		return nil, err
+	}
+	c.cache.invalidate()
+	tflog.Warn(ctx, "adopted instances of a launch whose response was lost", map[string]interface{}{
+		"name":         *req.Name,
+		"instance_ids": adopted,
+	})
+	if len(adopted) != req.Quantity {
+		return adopted, fmt.Errorf("recovered %d of %d instances after: %w", len(adopted), req.Quantity, err)
+	}
+	return adopted, nil
+}
+
+// findLaunchedInstances polls the instance list for instances named name that
+// were not running before the launch and are not claimed by another launch,
+// until exactly quantity of them show up or the search gives up. Only launches
+// with generated names, which no other launch shares, are partially
+// recovered.
+func (c *LambdaClient) findLaunchedInstances(ctx context.Context, name string, quantity int, existing map[string]bool) []string {
+	// The launch may still be in flight on the API side, keep looking for a
+	// while before concluding nothing was launched.
+	var found []string
+search:
+	for attempt := 0; attempt < c.orphanSearchAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(c.orphanSearchInterval):
+			case <-ctx.Done():
+				break search
+			}
+		}
+		instances, err := c.fetchInstances(ctx)
+		if err != nil {
+			continue
+		}
+		found = found[:0]
+		for _, instance := range instances {
+			if instance.Name == name && !existing[instance.Id] && instance.Status != instanceStatusTerminated {
+				found = append(found, instance.Id)
+			}
+		}
+		if ids, ok := c.claims.adopt(name, found, quantity); ok {
+			return ids
+		}
+	}
+	if isLaunchToken(name) {
+		ids, _ := c.claims.adopt(name, found, len(found))
+		return ids
+	}
+	return nil
+}
+
+// fetchInstances lists the instances bypassing the listing cache.
+func (c *LambdaClient) fetchInstances(ctx context.Context) ([]Instance, error) {
+	res, err := c.MakeAPICall(ctx, http.MethodGet, "instances", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, readAPIError(res)
+	}
+	var respData InstanceListAPIResponse
+	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
+		return nil, err
+	}
+	return respData.Data, nil
+}
+
+// launchClaims tracks the instances launches of a client have returned, and
+// the launches in flight by name, so that a launch whose outcome is unknown
+// never adopts an instance of another launch with the same name.
+type launchClaims struct {
+	mu       sync.Mutex
+	claimed  map[string]bool
+	inFlight map[string]int
+}
+
+func newLaunchClaims() *launchClaims {
+	return &launchClaims{claimed: map[string]bool{}, inFlight: map[string]int{}}
+}
+
+// begin records a launch call for name going out.
+func (l *launchClaims) begin(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight[name]++
+}
+
+// end records the launch call for name returning ids.
+func (l *launchClaims) end(name string, ids []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight[name]--
+	if l.inFlight[name] == 0 {
+		delete(l.inFlight, name)
+	}
+	for _, id := range ids {
+		l.claimed[id] = true
+	}
+}
+
+// adopt claims the unclaimed candidates named name when there are exactly
+// quantity of them. Nothing is adopted while another launch for name is in
+// flight, the candidates may be its instances.
+func (l *launchClaims) adopt(name string, candidates []string, quantity int) ([]string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[name] > 0 {
+		return nil, false
+	}
+	var ids []string
+	for _, id := range candidates {
+		if !l.claimed[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) != quantity {
+		return nil, false
+	}
+	for _, id := range ids {
+		l.claimed[id] = true
+	}
+	sort.Strings(ids)
+	return ids, true
+}
+
+// isAmbiguousLaunchError reports whether a failed launch may nevertheless have
+// started instances. Only API errors are definite, a request cancelled or
+// timed out on our side may already have been handled.
+func isAmbiguousLaunchError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	return true
+}
+
+func (c *LambdaClient) launchInstances(ctx context.Context, req InstanceCreateAPIRequest) ([]string, error) {
+	res, err := c.MakeAPICall(ctx, http.MethodPost, "instance-operations/launch", req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, readAPIError(res)
+	}
+	var respData InstanceCreateAPIResponse
+	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
+		return nil, err
+	}
+	if len(respData.Data.InstanceIds) != req.Quantity {
+		return respData.Data.InstanceIds, fmt.Errorf("expected %d instance ids, got %d", req.Quantity, len(respData.Data.InstanceIds))
+	}
+	return respData.Data.InstanceIds, nil
+}
+
+// LaunchInstance launches a single instance, coalescing it with identical
+// concurrent launches when a batch window is configured.
+func (c *LambdaClient) LaunchInstance(ctx context.Context, req InstanceCreateAPIRequest) (string, error) {
+	req.Quantity = 1
+	if c.batcher != nil {
+		return c.batcher.add(ctx, req)
+	}
+	ids, err := c.LaunchInstances(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+type launchResult struct {
+	id  string
+	err error
+}
+
+type launchWaiter struct {
+	ctx    context.Context
+	result chan launchResult
+}
+
+type launchBatch struct {
+	req     InstanceCreateAPIRequest
+	waiters []*launchWaiter
+}
+
+// launchBatcher groups launches with the same region, instance type, SSH keys,
+// file systems, name, image, user data and tags that arrive within window of
+// the first one into a single launch call, so capacity is claimed all at once.
+type launchBatcher struct {
+	window time.Duration
+	launch func(context.Context, InstanceCreateAPIRequest) ([]string, error)
+
+	mu      sync.Mutex
+	pending map[string]*launchBatch
+}
+
+func newLaunchBatcher(window time.Duration, launch func(context.Context, InstanceCreateAPIRequest) ([]string, error)) *launchBatcher {
+	return &launchBatcher{
+		window:  window,
+		launch:  launch,
+		pending: map[string]*launchBatch{},
+	}
+}
+
+func launchBatchKey(req InstanceCreateAPIRequest) string {
+	sshKeys := append([]string{}, req.SSHKeyNames...)
+	fileSystems := append([]string{}, req.FileSystemNames...)
+	sort.Strings(sshKeys)
+	sort.Strings(fileSystems)
+	name := "\x00"
+	if req.Name != nil {
+		name = *req.Name
+	}
+	image := "\x00"
+	if req.Image != nil {
+		image = req.Image.Id + "," + req.Image.Family
+	}
+	return strings.Join([]string{
+		req.RegionName,
+		req.InstanceTypeName,
+		strings.Join(sshKeys, ","),
+		strings.Join(fileSystems, ","),
+		name,
+		image,
+		req.UserData,
+		fmt.Sprint(req.Tags),
+	}, "\n")
+}
+
+func (b *launchBatcher) add(ctx context.Context, req InstanceCreateAPIRequest) (string, error) {
+	key := launchBatchKey(req)
+	waiter := &launchWaiter{ctx: ctx, result: make(chan launchResult, 1)}
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &launchBatch{req: req}
+		b.pending[key] = batch
+		time.AfterFunc(b.window, func() { b.flush(key) })
+	}
+	batch.waiters = append(batch.waiters, waiter)
+	b.mu.Unlock()
+
+	select {
+	case res := <-waiter.result:
+		return res.id, res.err
+	case <-ctx.Done():
+	}
+
+	// Leave the batch if it has not been sent yet, otherwise an instance is
+	// already being launched for this create and its id must be returned.
+	b.mu.Lock()
+	if b.pending[key] == batch {
+		for i, w := range batch.waiters {
+			if w == waiter {
+				batch.waiters = append(batch.waiters[:i], batch.waiters[i+1:]...)
+				break
+			}
+		}
+		b.mu.Unlock()
+		return "", ctx.Err()
+	}
+	b.mu.Unlock()
+	res := <-waiter.result
+	return res.id, res.err
+}
+
+func (b *launchBatcher) flush(key string) {
+	b.mu.Lock()
+	batch := b.pending[key]
+	delete(b.pending, key)
+	b.mu.Unlock()
+	if batch == nil || len(batch.waiters) == 0 {
+		return
+	}
+
+	// The launch must not be cut short by whichever create happens to be
+	// cancelled first, it keeps the first waiter's logger only.
+	ctx, cancel := context.WithTimeout(detachedContext{batch.waiters[0].ctx}, launchTimeout)
+	defer cancel()
+
+	req := batch.req
+	req.Quantity = len(batch.waiters)
+	tflog.Debug(ctx, "launching batched instances", map[string]interface{}{
+		"region_name":        req.RegionName,
+		"instance_type_name": req.InstanceTypeName,
+		"quantity":           req.Quantity,
+	})
+	ids, err := b.launch(ctx, req)
+	for i, w := range batch.waiters {
+		switch {
+		case i < len(ids):
+			w.result <- launchResult{id: ids[i], err: nil}
+		case err != nil:
+			w.result <- launchResult{err: err}
+		default:
+			w.result <- launchResult{err: fmt.Errorf("batched launch of %d instances returned %d ids", req.Quantity, len(ids))}
+		}
+	}
+}
+
+// detachedContext keeps the values of its parent, such as loggers, but is
+// never cancelled with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
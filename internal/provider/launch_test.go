@@ -0,0 +1,309 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+type fakeLauncher struct {
+	mu       sync.Mutex
+	requests []InstanceCreateAPIRequest
+	err      error
+}
+
+func (f *fakeLauncher) launch(ctx context.Context, req InstanceCreateAPIRequest) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return nil, f.err
+	}
+	ids := make([]string, req.Quantity)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s-%d-%d", req.RegionName, len(f.requests), i)
+	}
+	return ids, nil
+}
+
+func launchConcurrently(b *launchBatcher, reqs []InstanceCreateAPIRequest) ([]string, []error) {
+	ids := make([]string, len(reqs))
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req InstanceCreateAPIRequest) {
+			defer wg.Done()
+			ids[i], errs[i] = b.add(context.Background(), req)
+		}(i, req)
+	}
+	wg.Wait()
+	return ids, errs
+}
+
+func TestLaunchBatcherGroupsIdenticalLaunches(t *testing.T) {
+	launcher := &fakeLauncher{}
+	b := newLaunchBatcher(50*time.Millisecond, launcher.launch)
+	west := InstanceCreateAPIRequest{RegionName: "us-west-1", InstanceTypeName: "gpu_1x_a10", SSHKeyNames: []string{"laptop"}, Quantity: 1}
+	east := west
+	east.RegionName = "us-east-1"
+
+	ids, errs := launchConcurrently(b, []InstanceCreateAPIRequest{west, west, east, west})
+
+	seen := map[string]bool{}
+	for i, id := range ids {
+		if errs[i] != nil {
+			t.Fatalf("launch %d failed: %s", i, errs[i])
+		}
+		if seen[id] {
+			t.Fatalf("id %s handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if len(launcher.requests) != 2 {
+		t.Fatalf("expected 2 launch requests, got %+v", launcher.requests)
+	}
+	for _, req := range launcher.requests {
+		want := 1
+		if req.RegionName == "us-west-1" {
+			want = 3
+		}
+		if req.Quantity != want {
+			t.Errorf("%s launched with quantity %d, want %d", req.RegionName, req.Quantity, want)
+		}
+	}
+}
+
+func TestLaunchBatcherSharesErrors(t *testing.T) {
+	launcher := &fakeLauncher{err: errors.New("insufficient capacity")}
+	b := newLaunchBatcher(10*time.Millisecond, launcher.launch)
+	req := InstanceCreateAPIRequest{RegionName: "us-west-1", InstanceTypeName: "gpu_1x_a10", SSHKeyNames: []string{"laptop"}, Quantity: 1}
+
+	_, errs := launchConcurrently(b, []InstanceCreateAPIRequest{req, req})
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("launch %d did not fail", i)
+		}
+	}
+}
+
+func TestLaunchBatcherCancelBeforeFlush(t *testing.T) {
+	launcher := &fakeLauncher{}
+	b := newLaunchBatcher(100*time.Millisecond, launcher.launch)
+	req := InstanceCreateAPIRequest{RegionName: "us-west-1", InstanceTypeName: "gpu_1x_a10", SSHKeyNames: []string{"laptop"}, Quantity: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := b.add(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the cancelled launch to give up, got %v", err)
+		}
+	}()
+	if _, err := b.add(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if len(launcher.requests) != 1 || launcher.requests[0].Quantity != 1 {
+		t.Errorf("expected the cancelled launch to leave the batch, got %+v", launcher.requests)
+	}
+}
+
+func TestLaunchBatchKey(t *testing.T) {
+	name := "trainer"
+	a := InstanceCreateAPIRequest{RegionName: "us-west-1", InstanceTypeName: "gpu_1x_a10", SSHKeyNames: []string{"a", "b"}}
+	b := InstanceCreateAPIRequest{RegionName: "us-west-1", InstanceTypeName: "gpu_1x_a10", SSHKeyNames: []string{"b", "a"}}
+	named := a
+	named.Name = &name
+	if launchBatchKey(a) != launchBatchKey(b) {
+		t.Error("SSH key order should not split batches")
+	}
+	if launchBatchKey(a) == launchBatchKey(named) {
+		t.Error("named and unnamed launches must not share a batch")
+	}
+}
+
+func TestLaunchInstancesAdoptsOrphans(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	client.orphanSearchAttempts = 2
+	client.orphanSearchInterval = 10 * time.Millisecond
+	srv.AddFault(lambdamock.Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusGatewayTimeout, AfterCommit: true})
+
+	req := testMockLaunchRequest()
+	req.Quantity = 2
+	ids, err := client.LaunchInstances(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := srv.Instances()
+	if len(ids) != 2 || len(instances) != 2 {
+		t.Fatalf("expected both launched instances to be adopted, got %v of %d", ids, len(instances))
+	}
+	if !isLaunchToken(*instances[0].Name) {
+		t.Errorf("expected a generated launch name, got %q", *instances[0].Name)
+	}
+}
+
+// lostResponseTransport lets launch calls reach the API but holds their
+// responses back until the request context is done.
+type lostResponseTransport struct{}
+
+func (lostResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	res, err := http.DefaultTransport.RoundTrip(req.WithContext(context.Background()))
+	if err == nil {
+		res.Body.Close()
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestLaunchInstancesAdoptsOrphansAfterContextDone(t *testing.T) {
+	for name, newContext := range map[string]func() (context.Context, context.CancelFunc){
+		"deadline": func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 50*time.Millisecond)
+		},
+		"cancel": func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return ctx, cancel
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, srv := testMockClient(t, lambdamock.Options{})
+			client.httpClient = &http.Client{Transport: lostResponseTransport{}}
+			client.orphanSearchAttempts = 2
+			client.orphanSearchInterval = 10 * time.Millisecond
+
+			ctx, cancel := newContext()
+			defer cancel()
+			req := testMockLaunchRequest()
+			req.Quantity = 1
+			ids, err := client.LaunchInstances(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if instances := srv.Instances(); len(ids) != 1 || len(instances) != 1 || ids[0] != instances[0].ID {
+				t.Fatalf("expected the launched instance to be adopted, got %v", ids)
+			}
+		})
+	}
+}
+
+func TestLaunchInstancesIgnoresExistingNamesakes(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	client.orphanSearchAttempts = 2
+	client.orphanSearchInterval = 10 * time.Millisecond
+	name := "trainer"
+	req := testMockLaunchRequest()
+	req.Quantity = 1
+	req.Name = &name
+	existing, err := client.LaunchInstances(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.AddFault(lambdamock.Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusBadGateway, AfterCommit: true})
+	ids, err := client.LaunchInstances(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] == existing[0] {
+		t.Fatalf("adopted the wrong instance: %v, already running %v", ids, existing)
+	}
+}
+
+func TestLaunchInstancesConcurrentNamesakes(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{Latency: 20 * time.Millisecond})
+	client.orphanSearchAttempts = 2
+	client.orphanSearchInterval = 10 * time.Millisecond
+	// Whichever launch arrives first fails without launching anything.
+	srv.AddFault(lambdamock.Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusBadGateway, Times: 1})
+	name := "worker"
+	req := testMockLaunchRequest()
+	req.Quantity = 1
+	req.Name = &name
+
+	var wg sync.WaitGroup
+	ids := make([][]string, 2)
+	errs := make([]error, 2)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = client.LaunchInstances(context.Background(), req)
+		}(i)
+	}
+	wg.Wait()
+
+	if instances := srv.Instances(); len(instances) != 1 {
+		t.Fatalf("expected a single launched instance, got %d", len(instances))
+	}
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("expected exactly one launch to fail, got %v and %v (ids %v and %v)", errs[0], errs[1], ids[0], ids[1])
+	}
+}
+
+func TestLaunchClaimsAdoptExactly(t *testing.T) {
+	claims := newLaunchClaims()
+	if _, ok := claims.adopt("worker", []string{"a", "b"}, 1); ok {
+		t.Error("adopted one of two candidates")
+	}
+	claims.begin("worker")
+	if _, ok := claims.adopt("worker", []string{"a"}, 1); ok {
+		t.Error("adopted while another launch of the name was in flight")
+	}
+	claims.end("worker", []string{"a"})
+	if _, ok := claims.adopt("worker", []string{"a"}, 1); ok {
+		t.Error("adopted an instance another launch returned")
+	}
+	if ids, ok := claims.adopt("worker", []string{"a", "b"}, 1); !ok || len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("expected to adopt b, got %v", ids)
+	}
+}
+
+func TestLaunchInstancesDoesNotSearchAfterRejection(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	client.orphanSearchAttempts = 2
+	client.orphanSearchInterval = 10 * time.Millisecond
+	srv.SetCapacity("gpu_1x_a10", "us-west-1", 0)
+
+	req := testMockLaunchRequest()
+	req.Quantity = 1
+	_, err := client.LaunchInstances(context.Background(), req)
+	if err == nil {
+		t.Fatal("expected the capacity error")
+	}
+	if n := srv.RequestCount(http.MethodGet, "instances"); n != 0 {
+		t.Errorf("searched for orphans after a definite failure: %d listings", n)
+	}
+}
+
+func TestLaunchInstancesReportsLostLaunch(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{})
+	client.orphanSearchAttempts = 2
+	client.orphanSearchInterval = 10 * time.Millisecond
+	srv.AddFault(lambdamock.Fault{Method: http.MethodPost, Path: "instance-operations/launch", Status: http.StatusInternalServerError})
+
+	req := testMockLaunchRequest()
+	req.Quantity = 1
+	_, err := client.LaunchInstances(context.Background(), req)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected the original error, got %v", err)
+	}
+	if n := srv.RequestCount(http.MethodGet, "instances"); n != client.orphanSearchAttempts {
+		t.Errorf("expected %d searches, got %d", client.orphanSearchAttempts, n)
+	}
+}
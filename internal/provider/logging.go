@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// logSubsystem is the tflog subsystem API traffic is logged under, its level
+// can be set on its own with TF_LOG_PROVIDER_LAMBDALABS_API.
+const logSubsystem = "api"
+
+// logLevelEnvVars set the level of the subsystem, the first one set wins.
+var logLevelEnvVars = []string{
+	"TF_LOG_PROVIDER_LAMBDALABS_" + strings.ToUpper(logSubsystem),
+	"TF_LOG_PROVIDER_LAMBDALABS",
+	"TF_LOG_PROVIDER",
+	"TF_LOG",
+}
+
+// maxLoggedBodyLength caps the size of logged request and response bodies.
+const maxLoggedBodyLength = 64 << 10
+
+// logMaskedFields are the log fields whose values are always masked.
+var logMaskedFields = []string{
+	"http.request.header.authorization",
+	"private_key",
+	"jupyter_token",
+	"jupyter_url",
+	"api_key",
+}
+
+// logMaskedBodyValues masks secrets embedded in logged JSON bodies, which
+// field key masking cannot reach.
+var logMaskedBodyValues = regexp.MustCompile(`"(private_key|jupyter_token|jupyter_url|api_key)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+
+// loggingTransport logs every API request and response through tflog,
+// summaries at DEBUG and bodies at TRACE. Bodies are only read when logged.
+type loggingTransport struct {
+	apiKey string
+	next   http.RoundTripper
+}
+
+func newLoggingTransport(apiKey string, next http.RoundTripper) *loggingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &loggingTransport{apiKey: apiKey, next: next}
+}
+
+func (t *loggingTransport) logContext(ctx context.Context) context.Context {
+	ctx = tflog.NewSubsystem(ctx, logSubsystem, tflog.WithLevelFromEnv("TF_LOG_PROVIDER_LAMBDALABS", logSubsystem))
+	ctx = tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, logSubsystem, logMaskedFields...)
+	ctx = tflog.SubsystemMaskAllFieldValuesRegexes(ctx, logSubsystem, logMaskedBodyValues)
+	if t.apiKey != "" {
+		ctx = tflog.SubsystemMaskAllFieldValuesStrings(ctx, logSubsystem, t.apiKey)
+		ctx = tflog.SubsystemMaskMessageStrings(ctx, logSubsystem, t.apiKey)
+	}
+	return ctx
+}
+
+// logBodies reports whether the subsystem logs at TRACE, the only level bodies
+// are logged at. tflog cannot be asked, so the level is read from the same
+// environment variables it is set from.
+func logBodies() bool {
+	for _, name := range logLevelEnvVars {
+		if level := strings.ToUpper(os.Getenv(name)); level != "" {
+			return level == "TRACE" || level == "JSON"
+		}
+	}
+	return false
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := t.logContext(req.Context())
+	bodies := logBodies()
+	fields := map[string]interface{}{
+		"http.request.method": req.Method,
+		"http.request.path":   req.URL.Path,
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		fields["http.request.header.authorization"] = auth
+	}
+
+	var reqBody string
+	if bodies && req.Body != nil && req.Body != http.NoBody {
+		// The request belongs to the caller, only a copy gets the replaced
+		// body.
+		req = req.Clone(req.Context())
+		var err error
+		if reqBody, err = peekBody(&req.Body); err != nil {
+			return nil, err
+		}
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "Sending API request", fields)
+	if reqBody != "" {
+		tflog.SubsystemTrace(ctx, logSubsystem, "API request body", fields, map[string]interface{}{
+			"http.request.body": reqBody,
+		})
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	fields["http.duration_ms"] = time.Since(start).Milliseconds()
+	if err != nil {
+		tflog.SubsystemDebug(ctx, logSubsystem, "API request failed", fields, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return res, err
+	}
+
+	fields["http.response.status_code"] = res.StatusCode
+	for _, header := range requestIDHeaders {
+		if id := res.Header.Get(header); id != "" {
+			fields["http.response.request_id"] = id
+			break
+		}
+	}
+	var resBody string
+	if bodies {
+		if resBody, err = peekBody(&res.Body); err != nil {
+			return nil, err
+		}
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "Received API response", fields)
+	if resBody != "" {
+		tflog.SubsystemTrace(ctx, logSubsystem, "API response body", fields, map[string]interface{}{
+			"http.response.body": resBody,
+		})
+	}
+	return res, nil
+}
+
+// peekBody reads a body for logging and replaces it with an identical reader.
+func peekBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	raw, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return "", err
+	}
+	*body = io.NopCloser(bytes.NewReader(raw))
+	if len(raw) > maxLoggedBodyLength {
+		return string(raw[:maxLoggedBodyLength]) + "...", nil
+	}
+	return string(raw), nil
+}
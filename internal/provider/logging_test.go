@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func TestLoggingTransportMasksSecrets(t *testing.T) {
+	t.Setenv("TF_LOG_PROVIDER_LAMBDALABS_API", "TRACE")
+	srv := testMockServer(t, lambdamock.Options{})
+	client := NewLambdaClient(LambdaClientConfig{APIKey: "secret-api-key", Endpoint: srv.Endpoint()})
+
+	var output bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	res, err := client.MakeAPICall(ctx, http.MethodPost, "ssh-keys", SSHKeyCreateRequest{Name: "generated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", res.Status)
+	}
+
+	raw := output.String()
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sawResponse bool
+	for _, entry := range entries {
+		if entry["@module"] != "provider."+logSubsystem {
+			t.Errorf("entry logged outside of the %s subsystem: %v", logSubsystem, entry)
+		}
+		if entry["@message"] == "Received API response" {
+			sawResponse = true
+			if entry["http.request.method"] != http.MethodPost || entry["http.request.path"] != "/api/v1/ssh-keys" || entry["http.response.status_code"] != float64(200) {
+				t.Errorf("unexpected response entry %v", entry)
+			}
+			if _, ok := entry["http.duration_ms"]; !ok {
+				t.Errorf("response entry has no latency: %v", entry)
+			}
+		}
+	}
+	if !sawResponse {
+		t.Errorf("no response logged:\n%s", raw)
+	}
+
+	for _, secret := range []string{"secret-api-key", "BEGIN OPENSSH PRIVATE KEY", "Basic "} {
+		if strings.Contains(raw, secret) {
+			t.Errorf("log output leaks %q", secret)
+		}
+	}
+	if !strings.Contains(raw, "generated") {
+		t.Errorf("expected the request body to be logged:\n%s", raw)
+	}
+}
+
+func TestLoggingTransportBodies(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	transport := newLoggingTransport("mock", nil)
+	for _, level := range []string{"TRACE", "DEBUG"} {
+		t.Run(level, func(t *testing.T) {
+			for _, name := range logLevelEnvVars {
+				t.Setenv(name, "")
+			}
+			t.Setenv("TF_LOG", level)
+			var output bytes.Buffer
+			ctx := tflogtest.RootLogger(context.Background(), &output)
+			body := io.NopCloser(strings.NewReader(`{"name":"generated"}`))
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.Endpoint()+"/ssh-keys", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetBasicAuth("mock", "")
+			res, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if req.Body != body {
+				t.Error("RoundTrip modified the request")
+			}
+			if logged := strings.Contains(output.String(), "generated"); logged != (level == "TRACE") {
+				t.Errorf("body logged at %s: %t", level, logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// uniqueName returns prefix followed by the creation time and a random
+// suffix. The name is generated once, at create time, and then kept in state,
+// so every resource ends up with its own name however many share a prefix.
+func uniqueName(prefix string) (string, error) {
+	raw := make([]byte, 4)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return prefix + time.Now().UTC().Format("20060102150405") + hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUniqueName(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		name, err := uniqueName("ci-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^ci-\d{14}[0-9a-f]{8}$`).MatchString(name) {
+			t.Fatalf("unexpected name %q", name)
+		}
+		if seen[name] {
+			t.Fatalf("name %q generated twice", name)
+		}
+		seen[name] = true
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// launchPolicy restricts the regions and instance types instances may be
+// launched with. Patterns use path.Match syntax, e.g. "gpu_1x_*". A nil
+// allow list allows everything, an empty one nothing.
+type launchPolicy struct {
+	allowedRegions       []string
+	allowedInstanceTypes []string
+	deniedInstanceTypes  []string
+}
+
+func newLaunchPolicy(allowedRegions, allowedInstanceTypes, deniedInstanceTypes []string) *launchPolicy {
+	if allowedRegions == nil && allowedInstanceTypes == nil && len(deniedInstanceTypes) == 0 {
+		return nil
+	}
+	return &launchPolicy{
+		allowedRegions:       allowedRegions,
+		allowedInstanceTypes: allowedInstanceTypes,
+		deniedInstanceTypes:  deniedInstanceTypes,
+	}
+}
+
+// validatePatterns reports the first malformed pattern.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkRegion returns why region may not be launched in, or an empty string.
+func (p *launchPolicy) checkRegion(region string) string {
+	if p.allowedRegions != nil && !matchAny(p.allowedRegions, region) {
+		return fmt.Sprintf("Region %q is not allowed by the provider allowed_regions setting: %s.", region, formatPatterns(p.allowedRegions))
+	}
+	return ""
+}
+
+// checkInstanceType returns why instanceType may not be launched, or an empty
+// string. Denials win over allowances.
+func (p *launchPolicy) checkInstanceType(instanceType string) string {
+	for _, pattern := range p.deniedInstanceTypes {
+		if ok, _ := path.Match(pattern, instanceType); ok {
+			return fmt.Sprintf("Instance type %q is denied by the provider denied_instance_types pattern %q.", instanceType, pattern)
+		}
+	}
+	if p.allowedInstanceTypes != nil && !matchAny(p.allowedInstanceTypes, instanceType) {
+		return fmt.Sprintf("Instance type %q is not allowed by the provider allowed_instance_types setting: %s.", instanceType, formatPatterns(p.allowedInstanceTypes))
+	}
+	return ""
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func formatPatterns(patterns []string) string {
+	if len(patterns) == 0 {
+		return "nothing is allowed"
+	}
+	return strings.Join(patterns, ", ")
+}
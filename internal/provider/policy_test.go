@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestLaunchPolicy(t *testing.T) {
+	p := newLaunchPolicy([]string{"us-*"}, []string{"gpu_1x_*", "gpu_8x_h100_sxm5"}, []string{"*_h100_*"})
+
+	for _, tc := range []struct {
+		region, instanceType string
+		regionOK, typeOK     bool
+	}{
+		{"us-west-1", "gpu_1x_a10", true, true},
+		{"europe-central-1", "gpu_1x_a100", false, true},
+		{"us-east-1", "gpu_8x_a100", true, false},
+		{"us-east-1", "gpu_8x_h100_sxm5", true, false},
+	} {
+		if ok := p.checkRegion(tc.region) == ""; ok != tc.regionOK {
+			t.Errorf("checkRegion(%q) allowed = %t, want %t", tc.region, ok, tc.regionOK)
+		}
+		if ok := p.checkInstanceType(tc.instanceType) == ""; ok != tc.typeOK {
+			t.Errorf("checkInstanceType(%q) allowed = %t, want %t", tc.instanceType, ok, tc.typeOK)
+		}
+	}
+}
+
+func TestLaunchPolicyEmptyAllowList(t *testing.T) {
+	p := newLaunchPolicy([]string{}, nil, nil)
+	if p == nil || p.checkRegion("us-west-1") == "" {
+		t.Error("an empty allowed_regions should allow no region")
+	}
+	if p.checkInstanceType("gpu_1x_a10") != "" {
+		t.Error("an unset allowed_instance_types should allow every instance type")
+	}
+	if newLaunchPolicy(nil, nil, nil) != nil {
+		t.Error("expected no policy without restrictions")
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	if err := validatePatterns([]string{"gpu_[18]x_*"}); err != nil {
+		t.Error(err)
+	}
+	if err := validatePatterns([]string{"gpu_[1x"}); err == nil {
+		t.Error("expected the unterminated class to be rejected")
+	}
+}
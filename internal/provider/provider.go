@@ -2,24 +2,52 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
 )
 
 var _ provider.Provider = &LambdaProvider{}
 
 type LambdaProvider struct {
 	version string
+	// httpClient overrides the client used to reach the API, tests use it
+	// to record and replay interactions.
+	httpClient *http.Client
+	// dialSSH overrides how instances are reached over SSH, tests use it to
+	// reach an in-process SSH server.
+	dialSSH sshDialFunc
 }
 
 // LambdaProviderModel describes the provider data model.
 type LambdaProviderModel struct {
-	ApiKey types.String `tfsdk:"api_key"`
+	ApiKey                types.String  `tfsdk:"api_key"`
+	Endpoint              types.String  `tfsdk:"endpoint"`
+	MaxConcurrentRequests types.Int64   `tfsdk:"max_concurrent_requests"`
+	RequestsPerSecond     types.Float64 `tfsdk:"requests_per_second"`
+	LaunchBatchWindow     types.String  `tfsdk:"launch_batch_window"`
+	MaxHourlySpendCents   types.Int64   `tfsdk:"max_hourly_spend_cents"`
+	MaxInstances          types.Int64   `tfsdk:"max_instances"`
+	AllowedRegions        types.List    `tfsdk:"allowed_regions"`
+	AllowedInstanceTypes  types.List    `tfsdk:"allowed_instance_types"`
+	DeniedInstanceTypes   types.List    `tfsdk:"denied_instance_types"`
+	DefaultTags           types.Object  `tfsdk:"default_tags"`
+	DefaultRegion         types.String  `tfsdk:"default_region"`
+	DefaultSSHKeyNames    types.List    `tfsdk:"default_ssh_key_names"`
+}
+
+type DefaultTagsModel struct {
+	Tags types.Map `tfsdk:"tags"`
 }
 
 func (p *LambdaProvider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
@@ -35,12 +63,76 @@ func (p *LambdaProvider) Schema(ctx context.Context, req provider.SchemaRequest,
 				Optional:    true,
 				Description: "Lambda API key to use",
 			},
+			"endpoint": schema.StringAttribute{
+				Optional:    true,
+				Description: "Base URL of the Lambda Cloud API, can also be set with LAMBDA_API_ENDPOINT. Defaults to " + defaultEndpoint,
+			},
+			"max_concurrent_requests": schema.Int64Attribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Maximum number of API requests in flight at once, shared by every resource and data source. Set to 0 to disable. Defaults to %d", defaultMaxConcurrentRequests),
+			},
+			"requests_per_second": schema.Float64Attribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Maximum rate at which API requests are started, shared by every resource and data source. Set to 0 to disable. Defaults to %d", defaultRequestsPerSecond),
+			},
+			"launch_batch_window": schema.StringAttribute{
+				Optional: true,
+				Description: "How long an instance launch waits for other launches with the same region, instance type, SSH keys, " +
+					"file systems, name, image, user data and tags, to send them all as one launch request with a larger quantity, e.g. \"2s\". Disabled by default.",
+			},
+			"max_hourly_spend_cents": schema.Int64Attribute{
+				Optional: true,
+				Description: "Maximum hourly price in US cents of all running instances of the account plus the instances being planned. " +
+					"Plans that would exceed it fail. Unlimited by default.",
+			},
+			"max_instances": schema.Int64Attribute{
+				Optional: true,
+				Description: "Maximum number of running instances of the account plus the instances being planned. " +
+					"Plans that would exceed it fail. Unlimited by default.",
+			},
+			"allowed_regions": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Glob patterns of the regions instances may be launched in, e.g. \"us-*\". All regions are allowed by default.",
+			},
+			"allowed_instance_types": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Glob patterns of the instance types that may be launched, e.g. \"gpu_1x_*\". All instance types are allowed by default.",
+			},
+			"denied_instance_types": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Glob patterns of the instance types that may not be launched, taking precedence over allowed_instance_types.",
+			},
+			"default_region": schema.StringAttribute{
+				Optional:    true,
+				Description: "Region of the instances that do not set region_name",
+			},
+			"default_ssh_key_names": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "SSH keys of the instances that do not set ssh_key_names",
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"default_tags": schema.SingleNestedBlock{
+				Description: "Tags applied to every instance managed by the provider when it is launched. Changing them does not replace existing instances, which keep their tags until they are replaced for another reason.",
+				Attributes: map[string]schema.Attribute{
+					"tags": schema.MapAttribute{
+						Optional:    true,
+						ElementType: types.StringType,
+						Description: "Tags merged into the tags of every instance, tags set on an instance take precedence",
+					},
+				},
+			},
 		},
 	}
 }
 
 func (p *LambdaProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
 	apiKey := os.Getenv("LAMBDA_API_KEY")
+	endpoint := os.Getenv("LAMBDA_API_ENDPOINT")
 
 	var data LambdaProviderModel
 
@@ -53,6 +145,31 @@ func (p *LambdaProvider) Configure(ctx context.Context, req provider.ConfigureRe
 	if !data.ApiKey.IsNull() {
 		apiKey = data.ApiKey.ValueString()
 	}
+	if !data.Endpoint.IsNull() {
+		endpoint = data.Endpoint.ValueString()
+	}
+	maxConcurrentRequests := int64(defaultMaxConcurrentRequests)
+	if !data.MaxConcurrentRequests.IsNull() {
+		maxConcurrentRequests = data.MaxConcurrentRequests.ValueInt64()
+	}
+	if maxConcurrentRequests < 0 {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("max_concurrent_requests"),
+			"Invalid max_concurrent_requests",
+			"max_concurrent_requests must be 0 (unlimited) or greater.",
+		)
+	}
+	requestsPerSecond := float64(defaultRequestsPerSecond)
+	if !data.RequestsPerSecond.IsNull() {
+		requestsPerSecond = data.RequestsPerSecond.ValueFloat64()
+	}
+	if requestsPerSecond < 0 {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("requests_per_second"),
+			"Invalid requests_per_second",
+			"requests_per_second must be 0 (unlimited) or greater.",
+		)
+	}
 	if apiKey == "" {
 		resp.Diagnostics.AddError(
 			"Missing API key Configuration",
@@ -62,8 +179,94 @@ func (p *LambdaProvider) Configure(ctx context.Context, req provider.ConfigureRe
 		)
 	}
 
-	// Example client configuration for data sources and resources
-	resp.ResourceData = apiKey
+	var launchBatchWindow time.Duration
+	if !data.LaunchBatchWindow.IsNull() {
+		var err error
+		launchBatchWindow, err = time.ParseDuration(data.LaunchBatchWindow.ValueString())
+		if err != nil || launchBatchWindow < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("launch_batch_window"),
+				"Invalid launch_batch_window",
+				fmt.Sprintf("launch_batch_window must be a positive duration such as \"2s\", got %q.", data.LaunchBatchWindow.ValueString()),
+			)
+		}
+	}
+
+	var maxHourlySpendCents, maxInstances *int
+	if !data.MaxHourlySpendCents.IsNull() {
+		v := int(data.MaxHourlySpendCents.ValueInt64())
+		maxHourlySpendCents = &v
+		if v < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_hourly_spend_cents"),
+				"Invalid max_hourly_spend_cents",
+				"max_hourly_spend_cents must be 0 or greater.",
+			)
+		}
+	}
+	if !data.MaxInstances.IsNull() {
+		v := int(data.MaxInstances.ValueInt64())
+		maxInstances = &v
+		if v < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_instances"),
+				"Invalid max_instances",
+				"max_instances must be 0 or greater.",
+			)
+		}
+	}
+
+	allowedRegions := patternList(ctx, path.Root("allowed_regions"), data.AllowedRegions, &resp.Diagnostics)
+	allowedInstanceTypes := patternList(ctx, path.Root("allowed_instance_types"), data.AllowedInstanceTypes, &resp.Diagnostics)
+	deniedInstanceTypes := patternList(ctx, path.Root("denied_instance_types"), data.DeniedInstanceTypes, &resp.Diagnostics)
+
+	var defaultTags map[string]string
+	if !data.DefaultTags.IsNull() && !data.DefaultTags.IsUnknown() {
+		var block DefaultTagsModel
+		resp.Diagnostics.Append(data.DefaultTags.As(ctx, &block, basetypes.ObjectAsOptions{})...)
+		tags, diags := tagsFromValue(ctx, block.Tags)
+		resp.Diagnostics.Append(diags...)
+		defaultTags = tags
+	}
+
+	var defaultSSHKeyNames []string
+	if !data.DefaultSSHKeyNames.IsNull() && !data.DefaultSSHKeyNames.IsUnknown() {
+		resp.Diagnostics.Append(data.DefaultSSHKeyNames.ElementsAs(ctx, &defaultSSHKeyNames, false)...)
+	}
+
+	client := NewLambdaClient(LambdaClientConfig{
+		APIKey:                apiKey,
+		Endpoint:              endpoint,
+		HTTPClient:            p.httpClient,
+		MaxConcurrentRequests: int(maxConcurrentRequests),
+		RequestsPerSecond:     requestsPerSecond,
+		LaunchBatchWindow:     launchBatchWindow,
+		MaxHourlySpendCents:   maxHourlySpendCents,
+		MaxInstances:          maxInstances,
+		AllowedRegions:        allowedRegions,
+		AllowedInstanceTypes:  allowedInstanceTypes,
+		DeniedInstanceTypes:   deniedInstanceTypes,
+		DefaultTags:           defaultTags,
+		DefaultRegion:         data.DefaultRegion.ValueString(),
+		DefaultSSHKeyNames:    defaultSSHKeyNames,
+		DialSSH:               p.dialSSH,
+	})
+	resp.DataSourceData = client
+	resp.ResourceData = client
+}
+
+// patternList reads a list of glob patterns, returning nil when the list is
+// not set.
+func patternList(ctx context.Context, attr path.Path, list types.List, diags *diag.Diagnostics) []string {
+	if list.IsNull() || list.IsUnknown() {
+		return nil
+	}
+	patterns := []string{}
+	diags.Append(list.ElementsAs(ctx, &patterns, false)...)
+	if err := validatePatterns(patterns); err != nil {
+		diags.AddAttributeError(attr, "Invalid pattern", fmt.Sprintf("%s must hold glob patterns such as \"gpu_1x_*\": %s.", attr, err))
+	}
+	return patterns
 }
 
 func (p *LambdaProvider) Resources(ctx context.Context) []func() resource.Resource {
@@ -74,7 +277,10 @@ func (p *LambdaProvider) Resources(ctx context.Context) []func() resource.Resour
 }
 
 func (p *LambdaProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
-	return []func() datasource.DataSource{}
+	return []func() datasource.DataSource{
+		NewImagesDataSource,
+		NewCapacityDataSource,
+	}
 }
 
 func New(version string) func() provider.Provider {
@@ -1,9 +1,16 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
+	"github.com/dc-dc-dc/terraform-lambda/internal/cassette"
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
 )
@@ -17,3 +24,108 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal("LAMBDA_API_KEY not set")
 	}
 }
+
+// testAccCassette opens the cassette of the running test, as selected by
+// LAMBDA_CASSETTE_MODE. Cassettes live in testdata/cassettes and are written
+// when a recording test passes.
+func testAccCassette(t *testing.T) *cassette.Recorder {
+	mode, err := cassette.ModeFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := cassette.New(filepath.Join("testdata", "cassettes", t.Name()+".json"), mode, nil)
+	if err != nil {
+		t.Skip(err)
+	}
+	if mode == cassette.ModeReplay {
+		t.Setenv("LAMBDA_API_KEY", "replay")
+	}
+	t.Cleanup(func() {
+		// A failed or skipped test keeps the cassette it started with.
+		if t.Failed() || t.Skipped() {
+			return
+		}
+		if err := rec.Stop(); err != nil {
+			t.Errorf("saving cassette: %s", err)
+		}
+	})
+	return rec
+}
+
+// testAccProviderFactoriesWithCassette serves the provider with every API call
+// going through the cassette recorder.
+func testAccProviderFactoriesWithCassette(rec *cassette.Recorder) map[string]func() (tfprotov6.ProviderServer, error) {
+	return map[string]func() (tfprotov6.ProviderServer, error){
+		"lambdalabs": providerserver.NewProtocol6WithError(&LambdaProvider{
+			version:    "test",
+			httpClient: &http.Client{Transport: rec},
+		}),
+	}
+}
+
+// testMockProviderFactoriesWithSSH serves the provider with every SSH
+// connection made through dial.
+func testMockProviderFactoriesWithSSH(dial sshDialFunc) map[string]func() (tfprotov6.ProviderServer, error) {
+	return map[string]func() (tfprotov6.ProviderServer, error){
+		"lambdalabs": providerserver.NewProtocol6WithError(&LambdaProvider{
+			version: "test",
+			dialSSH: dial,
+		}),
+	}
+}
+
+// testMockPreCheck skips offline tests when no Terraform CLI is available to
+// drive them.
+func testMockPreCheck(t *testing.T) {
+	if os.Getenv("TF_ACC_TERRAFORM_PATH") != "" {
+		return
+	}
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform CLI not found, set TF_ACC_TERRAFORM_PATH to run tests against the mock API")
+	}
+}
+
+// testMockServer starts a fake Lambda API that is shut down with the test.
+func testMockServer(t *testing.T, opts lambdamock.Options) *lambdamock.Server {
+	srv := lambdamock.NewServer(opts)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testMockClient returns a client of a fake Lambda API that has the SSH key
+// laptop, used by testMockLaunchRequest.
+func testMockClient(t *testing.T, opts lambdamock.Options) (*LambdaClient, *lambdamock.Server) {
+	srv := testMockServer(t, opts)
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	return NewLambdaClient(LambdaClientConfig{APIKey: "mock", Endpoint: srv.Endpoint()}), srv
+}
+
+// testMockLaunchRequest launches a single instance with the SSH key of
+// testMockClient.
+func testMockLaunchRequest() InstanceCreateAPIRequest {
+	return InstanceCreateAPIRequest{
+		RegionName:       "us-west-1",
+		InstanceTypeName: "gpu_1x_a10",
+		SSHKeyNames:      []string{"laptop"},
+	}
+}
+
+// testMockLaunch launches an instance of testMockLaunchRequest and returns
+// its id.
+func testMockLaunch(t *testing.T, client *LambdaClient) string {
+	id, err := client.LaunchInstance(context.Background(), testMockLaunchRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testMockProviderConfig points the provider at a fake Lambda API.
+func testMockProviderConfig(srv *lambdamock.Server) string {
+	return fmt.Sprintf(`
+provider "lambdalabs" {
+  api_key  = "mock"
+  endpoint = %[1]q
+}
+`, srv.Endpoint())
+}
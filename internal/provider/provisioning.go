@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultProvisioningUser is the user of the Lambda Stack images.
+const defaultProvisioningUser = "ubuntu"
+
+type ProvisioningModel struct {
+	PrivateKey types.String `tfsdk:"private_key"`
+	User       types.String `tfsdk:"user"`
+	Commands   types.List   `tfsdk:"commands"`
+}
+
+// validateProvisioning checks the parts of the provisioning block that are
+// known while validating.
+func validateProvisioning(ctx context.Context, obj types.Object, diags *diag.Diagnostics) {
+	if obj.IsNull() || obj.IsUnknown() {
+		return
+	}
+	var model ProvisioningModel
+	diags.Append(obj.As(ctx, &model, basetypes.ObjectAsOptions{})...)
+	if diags.HasError() {
+		return
+	}
+	switch {
+	case model.PrivateKey.IsNull():
+		diags.AddAttributeError(path.Root("provisioning").AtName("private_key"), "Missing private_key",
+			"The provisioning block needs the private key to connect to the instance with.")
+	case !model.PrivateKey.IsUnknown():
+		if _, err := ssh.ParsePrivateKey([]byte(model.PrivateKey.ValueString())); err != nil {
+			diags.AddAttributeError(path.Root("provisioning").AtName("private_key"), "Invalid private_key", err.Error())
+		}
+	}
+	if model.Commands.IsNull() || (!model.Commands.IsUnknown() && len(model.Commands.Elements()) == 0) {
+		diags.AddAttributeError(path.Root("provisioning").AtName("commands"), "Missing commands",
+			"The provisioning block needs at least one command to run.")
+	}
+}
+
+// waitForSSH waits up to timeout for the freshly launched instance in data to
+// accept SSH connections and, unless capture_ssh_host_key is false, records its host
+// key. An unreachable instance is reported as an error so the instance gets
+// tainted.
+func (r *InstanceResource) waitForSSH(ctx context.Context, data *InstanceResourceModel, timeout time.Duration, diags *diag.Diagnostics) {
+	capture := data.CaptureSSHHostKey.IsNull() || data.CaptureSSHHostKey.ValueBool()
+	if data.IP.IsNull() {
+		diags.AddAttributeError(path.Root("wait_for_ssh"), "Instance not reachable over SSH",
+			fmt.Sprintf("Instance %s has no IP address to connect to.", data.Id.ValueString()))
+		return
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	key, err := r.client.WaitForSSH(waitCtx, data.IP.ValueString(), capture)
+	switch {
+	case err != nil:
+		diags.AddAttributeError(path.Root("wait_for_ssh"), "Instance not reachable over SSH",
+			fmt.Sprintf("Instance %s did not accept SSH connections within %s: %s", data.Id.ValueString(), timeout, err))
+	case !capture:
+		// Only the port was waited for.
+	case key == nil:
+		diags.AddAttributeWarning(path.Root("wait_for_ssh"), "SSH host key not captured",
+			fmt.Sprintf("Instance %s accepts connections on its SSH port but did not complete an SSH key exchange within %s.", data.Id.ValueString(), timeout))
+	default:
+		data.SSHHostKey = types.StringValue(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	}
+}
+
+// provision runs the provisioning commands on the freshly launched instance
+// in data, reporting a failure as an error so the instance gets tainted and
+// the output of a successful run as a warning.
+func (r *InstanceResource) provision(ctx context.Context, data *InstanceResourceModel, diags *diag.Diagnostics) {
+	var model ProvisioningModel
+	diags.Append(data.Provisioning.As(ctx, &model, basetypes.ObjectAsOptions{})...)
+	var commands []string
+	diags.Append(model.Commands.ElementsAs(ctx, &commands, false)...)
+	if diags.HasError() {
+		return
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(model.PrivateKey.ValueString()))
+	if err != nil {
+		diags.AddAttributeError(path.Root("provisioning").AtName("private_key"), "Invalid private_key", err.Error())
+		return
+	}
+	user := defaultProvisioningUser
+	if !model.User.IsNull() {
+		user = model.User.ValueString()
+	}
+	if data.IP.IsNull() {
+		diags.AddError("Provisioning failed", fmt.Sprintf("Instance %s has no IP address to connect to.", data.Id.ValueString()))
+		return
+	}
+
+	config := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		// The instance was just launched, unless wait_for_ssh captured its
+		// host key there is none known to check against.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if !data.SSHHostKey.IsNull() {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(data.SSHHostKey.ValueString()))
+		if err != nil {
+			diags.AddError("Provisioning failed", fmt.Sprintf("Invalid host key of instance %s: %s", data.Id.ValueString(), err))
+			return
+		}
+		config.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+	results, err := r.client.RunCommands(ctx, data.IP.ValueString(), config, commands)
+	for _, result := range results {
+		tflog.Info(ctx, "ran provisioning command", map[string]interface{}{
+			"instance_id": data.Id.ValueString(),
+			"command":     result.Command,
+			"exit_status": result.ExitStatus,
+			"output":      result.Output,
+		})
+	}
+	if err != nil {
+		diags.AddAttributeError(path.Root("provisioning"), "Provisioning failed",
+			provisioningDetail(fmt.Sprintf("Provisioning instance %s failed: %s", data.Id.ValueString(), err), results))
+		return
+	}
+	// The output is the only record of what provisioning did, show it
+	// rather than leave it in the logs.
+	diags.AddAttributeWarning(path.Root("provisioning"), "Provisioning output",
+		provisioningDetail(fmt.Sprintf("Provisioned instance %s.", data.Id.ValueString()), results))
+}
+
+// provisioningDetail describes a provisioning run, following summary with
+// the output and exit status of every command run.
+func provisioningDetail(summary string, results []commandResult) string {
+	var b strings.Builder
+	b.WriteString(summary)
+	for _, result := range results {
+		fmt.Fprintf(&b, "\n\n$ %s\n", result.Command)
+		if output := strings.TrimRight(result.Output, "\n"); output != "" {
+			fmt.Fprintf(&b, "%s\n", output)
+		}
+		if result.ExitStatus < 0 {
+			b.WriteString("(did not finish)")
+		} else {
+			fmt.Fprintf(&b, "(exit status %d)", result.ExitStatus)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,15 @@
+package provider
+
+import "testing"
+
+func TestProvisioningDetail(t *testing.T) {
+	got := provisioningDetail("Provisioned instance i-1.", []commandResult{
+		{Command: "nvidia-smi", ExitStatus: 0, Output: "GPU 0: A10\n"},
+		{Command: "true", ExitStatus: 0},
+		{Command: "sleep 600", ExitStatus: -1, Output: "..."},
+	})
+	want := "Provisioned instance i-1.\n\n$ nvidia-smi\nGPU 0: A10\n(exit status 0)\n\n$ true\n(exit status 0)\n\n$ sleep 600\n...\n(did not finish)"
+	if got != want {
+		t.Errorf("provisioningDetail() = %q, want %q", got, want)
+	}
+}
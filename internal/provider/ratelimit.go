@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMaxConcurrentRequests = 4
+	defaultRequestsPerSecond     = 5
+)
+
+// limitTransport bounds the API traffic of the whole provider: at most
+// cap(inFlight) requests are outstanding and requests start no faster than
+// the token bucket allows. A nil semaphore or limiter disables that limit.
+type limitTransport struct {
+	inFlight chan struct{}
+	limiter  *rate.Limiter
+	next     http.RoundTripper
+}
+
+func newLimitTransport(maxConcurrent int, requestsPerSecond float64, next http.RoundTripper) *limitTransport {
+	t := &limitTransport{next: next}
+	if maxConcurrent > 0 {
+		t.inFlight = make(chan struct{}, maxConcurrent)
+	}
+	if requestsPerSecond > 0 {
+		burst := int(requestsPerSecond)
+		if burst < 1 {
+			burst = 1
+		}
+		t.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+	return t
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.inFlight != nil {
+		select {
+		case t.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if t.limiter != nil {
+		if err := t.limiter.Wait(ctx); err != nil {
+			t.release()
+			return nil, err
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.release()
+		return nil, err
+	}
+	// The slot is held until the body is consumed, the connection is busy
+	// until then.
+	res.Body = &releaseOnClose{ReadCloser: res.Body, release: t.release}
+	return res, nil
+}
+
+func (t *limitTransport) release() {
+	if t.inFlight != nil {
+		<-t.inFlight
+	}
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport answers every request after a delay, tracking how many
+// requests were in flight at once.
+type countingTransport struct {
+	delay    time.Duration
+	inFlight int32
+	peak     int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := atomic.AddInt32(&t.inFlight, 1)
+	for {
+		peak := atomic.LoadInt32(&t.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&t.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	atomic.AddInt32(&t.inFlight, -1)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func runRequests(t *testing.T, transport http.RoundTripper, n int) {
+	t.Helper()
+	client := &http.Client{Transport: transport}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get("http://lambda.invalid/api/v1/instances")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLimitTransportMaxConcurrent(t *testing.T) {
+	next := &countingTransport{delay: 20 * time.Millisecond}
+	runRequests(t, newLimitTransport(3, 0, next), 12)
+	if next.peak > 3 {
+		t.Errorf("expected at most 3 requests in flight, saw %d", next.peak)
+	}
+}
+
+func TestLimitTransportRate(t *testing.T) {
+	next := &countingTransport{}
+	start := time.Now()
+	// The bucket starts full with 10 tokens, the 5 requests beyond that
+	// have to wait for 100ms each.
+	runRequests(t, newLimitTransport(0, 10, next), 15)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("15 requests at 10/s finished in %s", elapsed)
+	}
+}
+
+func TestLimitTransportCancel(t *testing.T) {
+	limit := newLimitTransport(1, 0, &countingTransport{})
+	limit.inFlight <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://lambda.invalid/api/v1/instances", nil)
+	if _, err := limit.RoundTrip(req); err == nil {
+		t.Fatal("expected the request to give up waiting for a slot")
+	}
+}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshPort is the port instances accept SSH connections on.
+const sshPort = "22"
+
+const (
+	// sshConnectTimeout bounds how long connecting to a freshly launched
+	// instance is retried by default, sshd comes up a little after the API
+	// reports the instance active.
+	sshConnectTimeout = 5 * time.Minute
+	sshRetryInterval  = 5 * time.Second
+	// sshHandshakeTimeout bounds the SSH handshake, a server that accepts
+	// connections without answering would hang it forever.
+	sshHandshakeTimeout = 30 * time.Second
+)
+
+// maxCommandOutput caps how much of the output of a provisioning command is
+// kept, the end of the output is where failures are explained.
+const maxCommandOutput = 4096
+
+// sshDialFunc opens network connections to instances.
+type sshDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// commandResult is the outcome of a command run over SSH. ExitStatus is -1
+// when the command did not run to completion.
+type commandResult struct {
+	Command    string
+	ExitStatus int
+	Output     string
+}
+
+// dialInstance opens a TCP connection to the SSH port of the instance at ip,
+// retrying refused and timed out connections until ctx is done.
+func (c *LambdaClient) dialInstance(ctx context.Context, ip string) (net.Conn, error) {
+	addr := net.JoinHostPort(ip, sshPort)
+	for {
+		conn, err := c.dialSSH(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		tflog.Debug(ctx, "waiting for SSH port to accept connections", map[string]interface{}{
+			"address": addr,
+			"error":   err.Error(),
+		})
+		select {
+		case <-time.After(c.sshRetryInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+		}
+	}
+}
+
+// connectSSH opens an SSH connection to the instance at ip.
+func (c *LambdaClient) connectSSH(ctx context.Context, ip string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := c.dialInstance(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// WaitForSSH waits until the SSH port of the instance at ip accepts
+// connections. With handshake it then returns the host key the server
+// presents during the key exchange, a server that accepts connections but
+// does not complete a key exchange before ctx is done counts as reachable,
+// with a nil key.
+func (c *LambdaClient) WaitForSSH(ctx context.Context, ip string, handshake bool) (ssh.PublicKey, error) {
+	reachable := false
+	for {
+		conn, err := c.dialInstance(ctx, ip)
+		if err != nil {
+			if reachable {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if !handshake {
+			conn.Close()
+			return nil, nil
+		}
+		reachable = true
+		key, err := sshHostKey(conn)
+		if key != nil {
+			return key, nil
+		}
+		tflog.Debug(ctx, "waiting for SSH key exchange", map[string]interface{}{
+			"address": conn.RemoteAddr().String(),
+			"error":   err.Error(),
+		})
+		select {
+		case <-time.After(c.sshRetryInterval):
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// sshHostKey runs an SSH handshake over conn, without credentials, to learn
+// the host key of the server. The key is returned even though the handshake
+// then fails authentication.
+func sshHostKey(conn net.Conn) (ssh.PublicKey, error) {
+	defer conn.Close()
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: defaultProvisioningUser,
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		},
+	}
+	_ = conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sshConn, _, _, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if err == nil {
+		sshConn.Close()
+	}
+	return hostKey, err
+}
+
+// RunCommands runs commands one after the other over SSH on the instance at
+// ip, stopping at the first that fails. The results of all commands run are
+// returned, including the failed one.
+func (c *LambdaClient) RunCommands(ctx context.Context, ip string, config *ssh.ClientConfig, commands []string) ([]commandResult, error) {
+	connectCtx, cancel := context.WithTimeout(ctx, sshConnectTimeout)
+	client, err := c.connectSSH(connectCtx, ip, config)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	// Closing the connection is the only way to interrupt a running command.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	var results []commandResult
+	for _, command := range commands {
+		result, err := runCommand(client, command)
+		results = append(results, result)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func runCommand(client *ssh.Client, command string) (commandResult, error) {
+	result := commandResult{Command: command, ExitStatus: -1}
+	session, err := client.NewSession()
+	if err != nil {
+		return result, err
+	}
+	defer session.Close()
+	output := &tailBuffer{max: maxCommandOutput}
+	session.Stdout = output
+	session.Stderr = output
+	err = session.Run(command)
+	result.Output = output.String()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitStatus = exitErr.ExitStatus()
+		return result, fmt.Errorf("command %q exited with status %d", command, result.ExitStatus)
+	}
+	if err == nil {
+		result.ExitStatus = 0
+	}
+	return result, err
+}
+
+// tailBuffer keeps the last max bytes written to it. Stdout and stderr of a
+// session are copied concurrently, so writes are serialized.
+type tailBuffer struct {
+	max int
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
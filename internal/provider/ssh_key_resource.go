@@ -18,6 +18,7 @@ import (
 // Ensure provider defined types fully satisfy framework interfaces.
 var _ resource.Resource = &SSHKeyResource{}
 var _ resource.ResourceWithImportState = &SSHKeyResource{}
+var _ resource.ResourceWithValidateConfig = &SSHKeyResource{}
 
 func NewSSHKeyResource() resource.Resource {
 	return &SSHKeyResource{}
@@ -25,12 +26,13 @@ func NewSSHKeyResource() resource.Resource {
 
 // SSHKeyResource defines the resource implementation.
 type SSHKeyResource struct {
-	apiKey string
+	client *LambdaClient
 }
 
 // SSHKeyResourceModel describes the resource data model.
 type SSHKeyResourceModel struct {
 	Name       types.String `tfsdk:"name"`
+	NamePrefix types.String `tfsdk:"name_prefix"`
 	PublicKey  types.String `tfsdk:"public_key"`
 	PrivateKey types.String `tfsdk:"private_key"`
 	Id         types.String `tfsdk:"id"`
@@ -67,8 +69,19 @@ func (r *SSHKeyResource) Schema(ctx context.Context, req resource.SchemaRequest,
 
 		Attributes: map[string]schema.Attribute{
 			"name": schema.StringAttribute{
-				MarkdownDescription: "Name of the SSH key.",
-				Required:            true,
+				MarkdownDescription: "Name of the SSH key. Generated when `name_prefix` is set.",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name_prefix": schema.StringAttribute{
+				MarkdownDescription: "Creates a unique name beginning with this prefix. Conflicts with `name`. Changing it replaces the SSH key.",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"public_key": schema.StringAttribute{
 				MarkdownDescription: "Public key for the ssk key.",
@@ -97,18 +110,33 @@ func (r *SSHKeyResource) Configure(ctx context.Context, req resource.ConfigureRe
 		return
 	}
 
-	apiKey, ok := req.ProviderData.(string)
+	client, ok := req.ProviderData.(*LambdaClient)
 
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Resource Configure Type",
-			fmt.Sprintf("Expected *http.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected *LambdaClient, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
 	}
 
-	r.apiKey = apiKey
+	r.client = client
+}
+
+func (r *SSHKeyResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data SSHKeyResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	switch {
+	case !data.Name.IsNull() && !data.NamePrefix.IsNull():
+		resp.Diagnostics.AddAttributeError(path.Root("name_prefix"), "Conflicting name", "Only one of name and name_prefix may be set.")
+	case data.Name.IsNull() && data.NamePrefix.IsNull():
+		resp.Diagnostics.AddAttributeError(path.Root("name"), "Missing name", "One of name and name_prefix must be set.")
+	}
 }
 
 func (r *SSHKeyResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
@@ -120,25 +148,28 @@ func (r *SSHKeyResource) Create(ctx context.Context, req resource.CreateRequest,
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	if data.Name.IsUnknown() {
+		name, err := uniqueName(data.NamePrefix.ValueString())
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Unable to generate SSH key name", err)
+			return
+		}
+		data.Name = types.StringValue(name)
+	}
 	raw := SSHKeyCreateRequest{
 		Name: data.Name.ValueString(),
 	}
 	if !data.PublicKey.IsNull() {
 		raw.PublicKey = data.PublicKey.ValueString()
 	}
-	res, err := MakeAPICall(ctx, r.apiKey, http.MethodPost, "ssh-keys", raw)
+	res, err := r.client.MakeAPICall(ctx, http.MethodPost, "ssh-keys", raw)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create example, got error: %s", err))
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create SSH key, got error: %s", err))
 		return
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(res.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
-			return
-		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
+		addAPIErrorDiagnostic(&resp.Diagnostics, "Unable to create SSH key", res)
 		return
 	}
 
@@ -170,29 +201,13 @@ func (r *SSHKeyResource) Read(ctx context.Context, req resource.ReadRequest, res
 		return
 	}
 
-	res, err := MakeAPICall(ctx, r.apiKey, http.MethodGet, "ssh-keys", nil)
+	keys, err := r.client.ListSSHKeys(ctx)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create example, got error: %s", err))
-		return
-	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(res.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
-			return
-		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
-		return
-	}
-
-	var respData SSHKeyListResponse
-	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
-		resp.Diagnostics.AddError("json error", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to list SSH keys", err)
 		return
 	}
 	// find the ssh-key in the list
-	key := findKey(respData.Data, data.Id.ValueString())
+	key := findKey(keys, data.Id.ValueString())
 	if key == nil {
 		resp.State.RemoveResource(ctx)
 		return
@@ -241,23 +256,48 @@ func (r *SSHKeyResource) Delete(ctx context.Context, req resource.DeleteRequest,
 		return
 	}
 
-	res, err := MakeAPICall(ctx, r.apiKey, http.MethodDelete, fmt.Sprintf("ssh-keys/%s", data.Id.ValueString()), nil)
+	res, err := r.client.MakeAPICall(ctx, http.MethodDelete, fmt.Sprintf("ssh-keys/%s", data.Id.ValueString()), nil)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create example, got error: %s", err))
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete SSH key, got error: %s", err))
 		return
 	}
+	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		defer res.Body.Close()
-		var errData InstanceAPIErrorResponse
-		if err := json.NewDecoder(res.Body).Decode(&errData); err != nil {
-			resp.Diagnostics.AddError("json error", err.Error())
-			return
-		}
-		resp.Diagnostics.AddError("client error", errData.Error.Message)
+		addAPIErrorDiagnostic(&resp.Diagnostics, "Unable to delete SSH key", res)
 		return
 	}
 }
 
 func (r *SSHKeyResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+	kind, value := parseImportID(req.ID)
+	if kind == "" {
+		resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+		return
+	}
+	if kind != "name" {
+		resp.Diagnostics.AddError(
+			"Invalid import ID",
+			fmt.Sprintf("Unsupported import ID prefix %q, expected an SSH key id or name:<name>.", kind),
+		)
+		return
+	}
+
+	keys, err := r.client.ListSSHKeys(ctx)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to list SSH keys", err)
+		return
+	}
+
+	var ids []string
+	for _, key := range keys {
+		if key.Name == value {
+			ids = append(ids, key.ID)
+		}
+	}
+	id, err := resolveImportID("SSH key", kind, value, ids)
+	if err != nil {
+		resp.Diagnostics.AddError("Cannot import SSH key", err.Error())
+		return
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), id)...)
 }
@@ -3,16 +3,20 @@ package provider
 import (
 	"fmt"
 	"math/rand"
+	"regexp"
 	"testing"
 
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
 )
 
 func TestAccSSHKeyResource(t *testing.T) {
-	name := fmt.Sprintf("testacc-sshkey-%d", rand.Int())
+	rec := testAccCassette(t)
+	name := rec.Var("name", func() string { return fmt.Sprintf("%ssshkey-%d", testAccResourcePrefix, rand.Int()) })
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		ProtoV6ProviderFactories: testAccProviderFactoriesWithCassette(rec),
 		Steps: []resource.TestStep{
 			// Create and Read testing
 			{
@@ -28,6 +32,131 @@ func TestAccSSHKeyResource(t *testing.T) {
 				ImportState:       true,
 				ImportStateVerify: true,
 			},
+			// ImportState by name testing
+			{
+				ResourceName:      "lambdalabs_sshkey.test",
+				ImportState:       true,
+				ImportStateId:     "name:" + name,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestSSHKeyResource_mock(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.SSHKeys()); n != 0 {
+				return fmt.Errorf("%d ssh keys left behind", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + testAccSSHKeyResourceConfig("mock-key"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("lambdalabs_sshkey.test", "name", "mock-key"),
+					resource.TestCheckResourceAttrSet("lambdalabs_sshkey.test", "id"),
+				),
+			},
+			{
+				Config:            testMockProviderConfig(srv) + testAccSSHKeyResourceConfig("mock-key"),
+				ResourceName:      "lambdalabs_sshkey.test",
+				ImportState:       true,
+				ImportStateId:     "name:mock-key",
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestSSHKeyResource_mockNamePrefix(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_sshkey" "test" {
+  public_key = "need some here"
+}
+`,
+				ExpectError: regexp.MustCompile("Missing name"),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_sshkey" "test" {
+  name_prefix = "ci-"
+  public_key  = "need some here"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestMatchResourceAttr("lambdalabs_sshkey.test", "name", regexp.MustCompile("^ci-")),
+					func(s *terraform.State) error {
+						name := s.RootModule().Resources["lambdalabs_sshkey.test"].Primary.Attributes["name"]
+						keys := srv.SSHKeys()
+						if len(keys) != 1 || keys[0].Name != name {
+							return fmt.Errorf("created keys %+v, want one named %q", keys, name)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: testMockProviderConfig(srv) + `
+resource "lambdalabs_sshkey" "test" {
+  name_prefix = "nightly-"
+  public_key  = "need some here"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestMatchResourceAttr("lambdalabs_sshkey.test", "name", regexp.MustCompile("^nightly-")),
+					func(s *terraform.State) error {
+						name := s.RootModule().Resources["lambdalabs_sshkey.test"].Primary.Attributes["name"]
+						keys := srv.SSHKeys()
+						if len(keys) != 1 || keys[0].Name != name {
+							return fmt.Errorf("keys %+v, want only one named %q", keys, name)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestSSHKeyResource_mockManyKeys(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	n := defaultMaxConcurrentRequests + 2
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:                 func() { testMockPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if n := len(srv.SSHKeys()); n != 0 {
+				return fmt.Errorf("%d ssh keys left behind", n)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testMockProviderConfig(srv) + fmt.Sprintf(`
+resource "lambdalabs_sshkey" "test" {
+  count      = %d
+  name       = "key-${count.index}"
+  public_key = "need some here"
+}
+`, n),
+				Check: func(*terraform.State) error {
+					if got := len(srv.SSHKeys()); got != n {
+						return fmt.Errorf("expected %d ssh keys, got %d", n, got)
+					}
+					return nil
+				},
+			},
 		},
 	})
 }
@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is an in-process SSH server running exec requests through a
+// handler instead of a shell.
+type testSSHServer struct {
+	addr       string
+	hostKey    ssh.PublicKey
+	privateKey string
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newTestSSHServer(t *testing.T, handle func(command string) (string, uint32)) *testSSHServer {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "ubuntu" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testSSHServer{
+		addr:       ln.Addr().String(),
+		hostKey:    hostSigner.PublicKey(),
+		privateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config, handle)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig, handle func(string) (string, uint32)) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range requests {
+				var exec struct{ Command string }
+				if req.Type != "exec" || ssh.Unmarshal(req.Payload, &exec) != nil {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				_ = req.Reply(true, nil)
+				s.mu.Lock()
+				s.commands = append(s.commands, exec.Command)
+				s.mu.Unlock()
+				output, status := handle(exec.Command)
+				_, _ = ch.Write([]byte(output))
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// dial connects to the server whatever address is asked for.
+func (s *testSSHServer) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, network, s.addr)
+}
+
+func (s *testSSHServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+func testShellHandler(command string) (string, uint32) {
+	if strings.HasPrefix(command, "exit ") {
+		return "failing\n", 3
+	}
+	return "ran " + command + "\n", 0
+}
+
+func testSSHClientConfig(t *testing.T, privateKey string) *ssh.ClientConfig {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ssh.ClientConfig{
+		User:            "ubuntu",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	srv := newTestSSHServer(t, testShellHandler)
+	client := NewLambdaClient(LambdaClientConfig{APIKey: "mock", DialSSH: srv.dial})
+
+	results, err := client.RunCommands(context.Background(), "10.0.0.1", testSSHClientConfig(t, srv.privateKey), []string{"uptime", "exit 3", "reboot"})
+	if err == nil {
+		t.Fatal("expected the failing command to fail the run")
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected the run to stop at the failing command, got %+v", results)
+	}
+	if results[0].Output != "ran uptime\n" || results[0].ExitStatus != 0 {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if results[1].Output != "failing\n" || results[1].ExitStatus != 3 {
+		t.Errorf("unexpected result %+v", results[1])
+	}
+	if got := srv.Commands(); len(got) != 2 {
+		t.Errorf("expected 2 commands run, got %v", got)
+	}
+}
+
+func TestRunCommandsUnauthorized(t *testing.T) {
+	srv := newTestSSHServer(t, testShellHandler)
+	other := newTestSSHServer(t, testShellHandler)
+	client := NewLambdaClient(LambdaClientConfig{APIKey: "mock", DialSSH: srv.dial})
+
+	_, err := client.RunCommands(context.Background(), "10.0.0.1", testSSHClientConfig(t, other.privateKey), []string{"uptime"})
+	if err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+	if got := srv.Commands(); len(got) != 0 {
+		t.Errorf("expected no commands run, got %v", got)
+	}
+}
+
+func TestDialInstanceRetries(t *testing.T) {
+	srv := newTestSSHServer(t, testShellHandler)
+	var attempts int
+	client := NewLambdaClient(LambdaClientConfig{
+		APIKey: "mock",
+		DialSSH: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if attempts++; attempts < 3 {
+				return nil, errors.New("connection refused")
+			}
+			return srv.dial(ctx, network, addr)
+		},
+	})
+	client.sshRetryInterval = 10 * time.Millisecond
+
+	conn, err := client.dialInstance(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 4}
+	_, _ = b.Write([]byte("ab"))
+	_, _ = b.Write([]byte("cdef"))
+	if got := b.String(); got != "cdef" {
+		t.Errorf("expected the last 4 bytes, got %q", got)
+	}
+}
+
+func TestWaitForSSH(t *testing.T) {
+	srv := newTestSSHServer(t, testShellHandler)
+	client := NewLambdaClient(LambdaClientConfig{APIKey: "mock", DialSSH: srv.dial})
+
+	key, err := client.WaitForSSH(context.Background(), "10.0.0.1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil || string(key.Marshal()) != string(srv.hostKey.Marshal()) {
+		t.Errorf("expected the server host key, got %v", key)
+	}
+}
+
+func TestWaitForSSHUnreachable(t *testing.T) {
+	client := NewLambdaClient(LambdaClientConfig{
+		APIKey: "mock",
+		DialSSH: func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	})
+	client.sshRetryInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.WaitForSSH(ctx, "10.0.0.1", true); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected the connection error, got %v", err)
+	}
+}
+
+func TestWaitForSSHNoKeyExchange(t *testing.T) {
+	// A port that accepts connections and closes them right away, like
+	// sshd starting up behind its socket.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	client := NewLambdaClient(LambdaClientConfig{
+		APIKey: "mock",
+		DialSSH: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, ln.Addr().String())
+		},
+	})
+	client.sshRetryInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	key, err := client.WaitForSSH(ctx, "10.0.0.1", true)
+	if err != nil || key != nil {
+		t.Fatalf("expected a reachable port without a host key, got %v, %v", key, err)
+	}
+}
+
+func TestWaitForSSHWithoutHandshake(t *testing.T) {
+	// A port that accepts connections but never answers, a handshake would
+	// hang until it times out.
+	var mu sync.Mutex
+	var held []net.Conn
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range held {
+			conn.Close()
+		}
+	})
+	client := NewLambdaClient(LambdaClientConfig{
+		APIKey: "mock",
+		DialSSH: func(context.Context, string, string) (net.Conn, error) {
+			conn, peer := net.Pipe()
+			mu.Lock()
+			held = append(held, peer)
+			mu.Unlock()
+			return conn, nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key, err := client.WaitForSSH(ctx, "10.0.0.1", false)
+	if err != nil || key != nil {
+		t.Fatalf("expected a reachable port without a host key, got %v, %v", key, err)
+	}
+	if ctx.Err() != nil {
+		t.Error("waited for a key exchange")
+	}
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// testAccResourcePrefix starts the name of every object created by
+// acceptance tests, sweepers delete whatever still carries it.
+const testAccResourcePrefix = "testacc-"
+
+// sweepAllRegions can be passed to -sweep to clean every region.
+const sweepAllRegions = "all"
+
+type FileSystem struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Region struct {
+		Name string `json:"name"`
+	} `json:"region"`
+}
+
+type FileSystemListAPIResponse struct {
+	Data []FileSystem `json:"data"`
+}
+
+func TestMain(m *testing.M) {
+	resource.TestMain(m)
+}
+
+func init() {
+	resource.AddTestSweepers("lambdalabs_instance", &resource.Sweeper{
+		Name: "lambdalabs_instance",
+		F:    sweepInstances,
+	})
+	resource.AddTestSweepers("lambdalabs_sshkey", &resource.Sweeper{
+		Name:         "lambdalabs_sshkey",
+		F:            sweepSSHKeys,
+		Dependencies: []string{"lambdalabs_instance"},
+	})
+	resource.AddTestSweepers("lambdalabs_file_system", &resource.Sweeper{
+		Name:         "lambdalabs_file_system",
+		F:            sweepFileSystems,
+		Dependencies: []string{"lambdalabs_instance"},
+	})
+}
+
+func sweeperClient() (*LambdaClient, error) {
+	apiKey := os.Getenv("LAMBDA_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("LAMBDA_API_KEY not set")
+	}
+	return NewLambdaClient(LambdaClientConfig{
+		APIKey:   apiKey,
+		Endpoint: os.Getenv("LAMBDA_API_ENDPOINT"),
+	}), nil
+}
+
+// sweepCall makes an API call and decodes a successful response into out.
+func sweepCall(client *LambdaClient, method, url string, data, out interface{}) error {
+	res, err := client.MakeAPICall(context.Background(), method, url, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %w", method, url, readAPIError(res))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func sweepRegion(sweep, region string) bool {
+	return sweep == sweepAllRegions || sweep == region
+}
+
+func sweepInstances(region string) error {
+	client, err := sweeperClient()
+	if err != nil {
+		return err
+	}
+	var instances InstanceListAPIResponse
+	if err := sweepCall(client, http.MethodGet, "instances", nil, &instances); err != nil {
+		return err
+	}
+	var ids []string
+	for _, instance := range instances.Data {
+		if !strings.HasPrefix(instance.Name, testAccResourcePrefix) || !sweepRegion(region, instance.Region.Name) {
+			continue
+		}
+		if instance.Status == "terminated" || instance.Status == "terminating" {
+			continue
+		}
+		ids = append(ids, instance.Id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return sweepCall(client, http.MethodPost, "instance-operations/terminate", InstanceDeleteApiRequest{InstanceIds: ids}, nil)
+}
+
+// sweepSSHKeys removes leaked keys, SSH keys are not regional so every
+// region sweeps all of them.
+func sweepSSHKeys(string) error {
+	client, err := sweeperClient()
+	if err != nil {
+		return err
+	}
+	var keys SSHKeyListResponse
+	if err := sweepCall(client, http.MethodGet, "ssh-keys", nil, &keys); err != nil {
+		return err
+	}
+	for _, key := range keys.Data {
+		if !strings.HasPrefix(key.Name, testAccResourcePrefix) {
+			continue
+		}
+		if err := sweepCall(client, http.MethodDelete, fmt.Sprintf("ssh-keys/%s", key.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sweepFileSystems(region string) error {
+	client, err := sweeperClient()
+	if err != nil {
+		return err
+	}
+	var fileSystems FileSystemListAPIResponse
+	if err := sweepCall(client, http.MethodGet, "file-systems", nil, &fileSystems); err != nil {
+		return err
+	}
+	for _, fs := range fileSystems.Data {
+		if !strings.HasPrefix(fs.Name, testAccResourcePrefix) || !sweepRegion(region, fs.Region.Name) {
+			continue
+		}
+		if err := sweepCall(client, http.MethodDelete, fmt.Sprintf("filesystems/%s", fs.Id), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSweepers_mock(t *testing.T) {
+	srv := testMockServer(t, lambdamock.Options{})
+	t.Setenv("LAMBDA_API_KEY", "mock")
+	t.Setenv("LAMBDA_API_ENDPOINT", srv.Endpoint())
+
+	srv.AddSSHKey(testAccResourcePrefix+"sshkey-1", "ssh-ed25519 AAAA")
+	srv.AddSSHKey("laptop", "ssh-ed25519 AAAA")
+	srv.AddFileSystem(testAccResourcePrefix+"fs-west", "us-west-1")
+	srv.AddFileSystem(testAccResourcePrefix+"fs-east", "us-east-1")
+	client, _ := sweeperClient()
+	for _, launch := range []struct{ name, region string }{
+		{testAccResourcePrefix + "instance-1", "us-west-1"},
+		{testAccResourcePrefix + "instance-2", "us-east-1"},
+		{"training", "us-west-1"},
+	} {
+		name := launch.name
+		err := sweepCall(client, http.MethodPost, "instance-operations/launch", InstanceCreateAPIRequest{
+			RegionName:       launch.region,
+			InstanceTypeName: "gpu_1x_a10",
+			SSHKeyNames:      []string{"laptop"},
+			Quantity:         1,
+			Name:             &name,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sweep := range []func(string) error{sweepInstances, sweepSSHKeys, sweepFileSystems} {
+		if err := sweep("us-west-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if instances := srv.Instances(); len(instances) != 2 {
+		t.Errorf("expected the us-east-1 and untagged instances to survive, got %d", len(instances))
+	}
+	if keys := srv.SSHKeys(); len(keys) != 1 || keys[0].Name != "laptop" {
+		t.Errorf("expected only the laptop key to survive, got %+v", keys)
+	}
+	if fileSystems := srv.FileSystems(); len(fileSystems) != 1 || fileSystems[0].Region.Name != "us-east-1" {
+		t.Errorf("expected only the us-east-1 file system to survive, got %+v", fileSystems)
+	}
+}
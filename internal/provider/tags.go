@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// mergeTags returns the provider default tags overridden by the resource
+// tags.
+func mergeTags(defaults, tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(tags))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// tagList converts tags to the API representation, sorted by key so that
+// identical tags always produce identical requests.
+func tagList(tags map[string]string) []Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	list := make([]Tag, 0, len(tags))
+	for k, v := range tags {
+		list = append(list, Tag{Key: k, Value: v})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// missingTags lists the keys of want, sorted, that have lacks or holds a
+// different value for.
+func missingTags(want, have map[string]string) []string {
+	var missing []string
+	for k, v := range want {
+		if w, ok := have[k]; !ok || w != v {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func tagMap(list []Tag) map[string]string {
+	tags := make(map[string]string, len(list))
+	for _, tag := range list {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+func tagsValue(ctx context.Context, tags map[string]string) (types.Map, diag.Diagnostics) {
+	return types.MapValueFrom(ctx, types.StringType, tags)
+}
+
+func tagsFromValue(ctx context.Context, value types.Map) (map[string]string, diag.Diagnostics) {
+	tags := map[string]string{}
+	if value.IsNull() || value.IsUnknown() {
+		return tags, nil
+	}
+	diags := value.ElementsAs(ctx, &tags, false)
+	return tags, diags
+}
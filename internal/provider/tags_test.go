@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	got := mergeTags(map[string]string{"team": "ml", "env": "dev"}, map[string]string{"env": "prod"})
+	want := map[string]string{"team": "ml", "env": "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTags() = %v, want %v", got, want)
+	}
+}
+
+func TestTagList(t *testing.T) {
+	got := tagList(map[string]string{"b": "2", "a": "1"})
+	want := []Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tagList() = %v, want %v", got, want)
+	}
+	if tagList(nil) != nil {
+		t.Error("expected no tags to be omitted from requests")
+	}
+}
+
+func TestMissingTags(t *testing.T) {
+	got := missingTags(map[string]string{"a": "1", "b": "2", "c": "3"}, map[string]string{"a": "1", "b": "x"})
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingTags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// maxUserDataBytes is the largest user data the launch API accepts, after
+// decoding.
+const maxUserDataBytes = 1 << 20
+
+// decodeUserData turns user_data_base64 into the plain cloud-init document
+// sent to the API, inflating it when it is gzip compressed as produced by the
+// cloudinit_config data source.
+func decodeUserData(encoded string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("not valid base64: %w", err)
+	}
+	if len(raw) >= 2 && raw[0] == 0x1f && raw[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return "", fmt.Errorf("not valid gzip: %w", err)
+		}
+		defer zr.Close()
+		// Read one byte past the limit to tell a full document from an
+		// oversized one.
+		raw, err = io.ReadAll(io.LimitReader(zr, maxUserDataBytes+1))
+		if err != nil {
+			return "", fmt.Errorf("not valid gzip: %w", err)
+		}
+	}
+	if err := checkUserDataSize(len(raw)); err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func checkUserDataSize(n int) error {
+	if n > maxUserDataBytes {
+		return fmt.Errorf("user data is larger than %d bytes", maxUserDataBytes)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func gzipBase64(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecodeUserData(t *testing.T) {
+	const cloudConfig = "#cloud-config\npackages:\n  - htop\n"
+
+	for name, encoded := range map[string]string{
+		"plain": base64.StdEncoding.EncodeToString([]byte(cloudConfig)),
+		"gzip":  gzipBase64(t, cloudConfig),
+	} {
+		got, err := decodeUserData(encoded)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if got != cloudConfig {
+			t.Errorf("%s: decoded %q", name, got)
+		}
+	}
+}
+
+func TestDecodeUserDataInvalid(t *testing.T) {
+	for name, encoded := range map[string]string{
+		"base64":    "#cloud-config",
+		"gzip":      base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0x00}),
+		"oversized": gzipBase64(t, strings.Repeat("a", maxUserDataBytes+1)),
+	} {
+		if _, err := decodeUserData(encoded); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	instanceStatusBooting    = "booting"
+	instanceStatusActive     = "active"
+	instanceStatusUnhealthy  = "unhealthy"
+	instanceStatusTerminated = "terminated"
+)
+
+const (
+	instanceBootTimeout  = 20 * time.Minute
+	instancePollInterval = 10 * time.Second
+)
+
+// GetInstance fetches a single instance, bypassing the listing cache so that
+// polls observe status changes.
+func (c *LambdaClient) GetInstance(ctx context.Context, id string) (*Instance, error) {
+	res, err := c.MakeAPICall(ctx, http.MethodGet, "instances/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, readAPIError(res)
+	}
+	var respData InstanceGetAPIResponse
+	if err := json.NewDecoder(res.Body).Decode(&respData); err != nil {
+		return nil, err
+	}
+	return &respData.Data, nil
+}
+
+// WaitForInstanceActive polls an instance until it is active. It gives up with
+// an error once the instance turns unhealthy or terminated, and with the
+// context's error when ctx is done; the last observed instance is returned in
+// every case so callers can record how far it got.
+func (c *LambdaClient) WaitForInstanceActive(ctx context.Context, id string) (*Instance, error) {
+	var last *Instance
+	for {
+		instance, err := c.GetInstance(ctx, id)
+		switch {
+		case ctx.Err() != nil:
+			return last, ctx.Err()
+		case err != nil:
+			return last, err
+		}
+		last = instance
+		switch instance.Status {
+		case instanceStatusActive:
+			return instance, nil
+		case instanceStatusUnhealthy, instanceStatusTerminated:
+			return instance, fmt.Errorf("instance %s is %s", id, instance.Status)
+		}
+		tflog.Debug(ctx, "waiting for instance to become active", map[string]interface{}{
+			"instance_id": id,
+			"status":      instance.Status,
+		})
+		select {
+		case <-time.After(c.instancePollInterval):
+		case <-ctx.Done():
+			return last, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dc-dc-dc/terraform-lambda/internal/lambdamock"
+)
+
+func TestWaitForInstanceActive(t *testing.T) {
+	client, _ := testMockClient(t, lambdamock.Options{BootTime: 50 * time.Millisecond})
+	client.instancePollInterval = 10 * time.Millisecond
+	id := testMockLaunch(t, client)
+
+	instance, err := client.WaitForInstanceActive(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status != instanceStatusActive || instance.IP == "" {
+		t.Errorf("expected an active instance with an address, got %+v", instance)
+	}
+}
+
+func TestWaitForInstanceActiveUnhealthy(t *testing.T) {
+	client, srv := testMockClient(t, lambdamock.Options{BootTime: time.Hour})
+	client.instancePollInterval = 10 * time.Millisecond
+	id := testMockLaunch(t, client)
+	srv.SetInstanceStatus(id, lambdamock.StatusUnhealthy)
+
+	instance, err := client.WaitForInstanceActive(context.Background(), id)
+	if err == nil {
+		t.Fatal("expected an unhealthy instance to fail the wait")
+	}
+	if instance == nil || instance.Status != instanceStatusUnhealthy {
+		t.Errorf("expected the unhealthy instance, got %+v", instance)
+	}
+}
+
+func TestWaitForInstanceActiveCancel(t *testing.T) {
+	client, _ := testMockClient(t, lambdamock.Options{BootTime: time.Hour})
+	client.instancePollInterval = 10 * time.Millisecond
+	id := testMockLaunch(t, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	instance, err := client.WaitForInstanceActive(ctx, id)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to stop with the context, got %v", err)
+	}
+	if instance == nil || instance.Status != instanceStatusBooting {
+		t.Errorf("expected the booting instance, got %+v", instance)
+	}
+}